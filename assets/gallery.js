@@ -1,5 +1,189 @@
 void function () {
 
+document.addEventListener('keydown', async evt => {
+    let link = document.activeElement.closest('#gallery a') || document.querySelector('#gallery a:hover');
+    if (!link) return;
+
+    // b picks the best of a stack, and rejects the rest
+    if (evt.key === 'b' && link.dataset.stack && !(evt.altKey || evt.ctrlKey || evt.metaKey || evt.repeat)) {
+        evt.preventDefault();
+        for (let a of document.querySelectorAll(`#gallery a[data-stack="${link.dataset.stack}"]`)) {
+            if (!await cull(a, { flag: a === link ? 'pick' : 'reject' })) break;
+        }
+        return;
+    }
+
+    let query = cullingKey(evt, link.dataset);
+    if (!query) return;
+    evt.preventDefault();
+    await cull(link, query);
+});
+
+async function cull(link, query) {
+    try {
+        let res = await fetch(link.pathname + '?cull', {
+            method: 'POST',
+            headers: { 'Accept': 'application/json' },
+            body: new URLSearchParams(query),
+        });
+        if (!res.ok) throw {
+            status: res.status,
+            name: res.statusText,
+            message: await res.json(),
+        };
+        Object.assign(link.dataset, query);
+        return true;
+    } catch (err) {
+        alertError('Culling failed', err);
+        return false;
+    }
+}
+
+// Expand or collapse stacks.
+document.getElementById('gallery').addEventListener('click', evt => {
+    let badge = evt.target.closest('span.stack');
+    if (!badge) return;
+    evt.preventDefault();
+    let stack = badge.parentElement.dataset.stack;
+    for (let a of document.querySelectorAll(`#gallery a[data-stack="${stack}"]`)) {
+        a.classList.toggle('expanded');
+    }
+});
+
+window.filterDialog = () => {
+    let dialog = document.getElementById('filter-dialog');
+    dialog.showModal();
+};
+
+document.getElementById('filter-form').addEventListener('submit', evt => {
+    evt.preventDefault();
+    let query = new URLSearchParams();
+    for (let [key, val] of new FormData(evt.target)) {
+        if (val !== '' && val !== '0') query.append(key, val);
+    }
+    location.search = query;
+});
+
+window.toggleRecursive = () => {
+    let query = new URLSearchParams(location.search);
+    if (query.has('recursive')) {
+        query.delete('recursive');
+    } else {
+        query.set('recursive', 'true');
+    }
+    query.delete('page');
+    location.search = query;
+};
+
+// Load the next page when scrolling past the end of the gallery.
+{
+    let loading = false;
+    let observer = new IntersectionObserver(async entries => {
+        if (loading || !entries.some(e => e.isIntersecting)) return;
+        let next = document.getElementById('next-page');
+        if (!next) return;
+
+        loading = true;
+        try {
+            let res = await fetch(next.href);
+            if (!res.ok) return;
+            let doc = new DOMParser().parseFromString(await res.text(), 'text/html');
+            let gallery = document.getElementById('gallery');
+            for (let a of doc.querySelectorAll('#gallery>a')) {
+                gallery.append(document.adoptNode(a));
+            }
+            let pager = document.getElementById('pager');
+            let newPager = doc.getElementById('pager');
+            if (newPager) {
+                // keep the previous link of the first page
+                let prev = pager.querySelector('#prev-page');
+                let newPrev = newPager.querySelector('#prev-page');
+                if (newPrev) newPrev.remove();
+                if (prev) newPager.prepend(prev);
+                pager.replaceWith(document.adoptNode(newPager));
+                observer.observe(document.getElementById('pager'));
+            }
+        } finally {
+            loading = false;
+        }
+    }, { rootMargin: '800px' });
+
+    let pager = document.getElementById('pager');
+    if (pager) observer.observe(pager);
+}
+
+// Show the metadata of the photo under the pointer, or focused.
+{
+    const tags = [
+        'EXIF:Make', 'EXIF:Model', 'Composite:LensID', 'EXIF:DateTimeOriginal',
+        'EXIF:ExposureTime', 'EXIF:FNumber', 'EXIF:ISO', 'EXIF:FocalLength',
+        'Composite:ImageSize', 'File:FileSize',
+    ];
+    let panel = document.getElementById('info-panel');
+    let button = document.getElementById('info');
+    let cache = new Map();
+    let current;
+
+    window.toggleInfo = () => {
+        panel.hidden = !panel.hidden;
+        button.classList.toggle('pushed', !panel.hidden);
+        let link = document.activeElement.closest('#gallery a') || document.querySelector('#gallery a:hover');
+        if (link) showInfo(link);
+    };
+
+    let gallery = document.getElementById('gallery');
+    gallery.addEventListener('mouseover', evt => showInfo(evt.target.closest('#gallery a')));
+    gallery.addEventListener('focusin', evt => showInfo(evt.target.closest('#gallery a')));
+
+    async function showInfo(link) {
+        if (panel.hidden || !link || link.pathname === current) return;
+        current = link.pathname;
+
+        let meta = cache.get(current);
+        if (!meta) {
+            let query = new URLSearchParams({ meta: 'json' });
+            for (let t of tags) query.append('tags', t);
+            let res = await fetch(current + '?' + query);
+            if (!res.ok) return;
+            meta = {};
+            // flatten the groups
+            for (let group of Object.values(await res.json())) {
+                if (typeof group === 'object') Object.assign(meta, group);
+            }
+            cache.set(link.pathname, meta);
+            if (link.pathname !== current) return;
+        }
+
+        let camera = [meta.Make, meta.Model].filter(Boolean).join(' ');
+        if (meta.Make && String(meta.Model).startsWith(String(meta.Make).split(' ')[0])) camera = meta.Model;
+        let exposure = [
+            meta.ExposureTime && meta.ExposureTime + ' s',
+            meta.FNumber && 'f/' + meta.FNumber,
+            meta.ISO && 'ISO ' + meta.ISO,
+            meta.FocalLength,
+        ].filter(Boolean).join(', ');
+
+        let dl = panel.querySelector('dl');
+        dl.textContent = '';
+        for (let [name, value] of [
+            ['Name', decodeURIComponent(current.split('/').pop())],
+            ['Date', meta.DateTimeOriginal],
+            ['Camera', camera],
+            ['Lens', meta.LensID],
+            ['Exposure', exposure],
+            ['Size', [meta.ImageSize, meta.FileSize].filter(Boolean).join(', ')],
+        ]) {
+            if (!value) continue;
+            let dt = document.createElement('dt');
+            let dd = document.createElement('dd');
+            dt.textContent = name;
+            dd.textContent = value;
+            dd.title = value;
+            dl.append(dt, dd);
+        }
+    }
+}
+
 if (!template.uploadPath) return;
 
 let form = document.createElement('input');
@@ -117,4 +117,25 @@ function alertError(src, err) {
     } else {
         alert(name + '\n' + src + '.');
     }
-}
\ No newline at end of file
+}
+// Culling shortcuts: 0-5 rate, 6-9 label (again to clear), p pick, x reject, u unflag.
+// Returns the changes to current (a rating, label, flag object), or null.
+function cullingKey(evt, current) {
+    if (evt.altKey || evt.ctrlKey || evt.metaKey || evt.repeat) return null;
+    if (evt.target.closest && evt.target.closest('input, select, textarea')) return null;
+
+    var labels = { '6': 'Red', '7': 'Yellow', '8': 'Green', '9': 'Blue' };
+    if (/^[0-5]$/.test(evt.key)) {
+        return { rating: evt.key };
+    }
+    if (evt.key in labels) {
+        var label = labels[evt.key];
+        return { label: current.label === label ? '' : label };
+    }
+    switch (evt.key.toLowerCase()) {
+        case 'p': return { flag: 'pick' };
+        case 'x': return { flag: 'reject' };
+        case 'u': return { flag: '' };
+    }
+    return null;
+}
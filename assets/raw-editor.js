@@ -8,6 +8,7 @@ let white = document.getElementById('white');
 let photo = document.getElementById('photo');
 let print = document.getElementById('print');
 let spinner = document.getElementById('spinner');
+let culling = document.getElementById('culling');
 
 async function loadSettings() {
     if (form.hidden || !form.querySelector('fieldset').disabled) return;
@@ -23,6 +24,8 @@ async function loadSettings() {
 
     if (settings === '') return;
 
+    if (culling) showCulling(settings);
+
     let upgraded = false;
     if (settings.process == null || settings.process < 6.7 || settings > 11) {
         if (settings.process) alert('This file was processed with an incompatible version of Camera Raw.\nPrevious edits will not be faithfully reproduced.');
@@ -241,6 +244,8 @@ window.saveFile = async () => {
 
 window.exportFile = async state => {
     if (state === 'dialog') {
+        await loadWatermarks();
+        await loadPresets();
         exportChange(document.getElementById('export-form'));
         let dialog = document.getElementById('export-dialog');
         dialog.addEventListener('close', () => {
@@ -253,6 +258,15 @@ window.exportFile = async state => {
     let query = formQuery();
     if (state === 'export') exportQuery(query);
 
+    // server batch exports download as a ZIP
+    if (!photo && document.body.dataset.server !== void 0 && !query.has('dest')) {
+        let a = document.createElement('a');
+        a.href = '?export&' + query;
+        a.download = '';
+        a.click();
+        return;
+    }
+
     let dialog = document.getElementById('progress-dialog');
     let progress = dialog.querySelector('progress');
     progress.removeAttribute('value');
@@ -266,6 +280,441 @@ window.exportFile = async state => {
     dialog.close();
 };
 
+window.contactSheet = async state => {
+    let form = document.getElementById('contact-form');
+    if (state === 'dialog') {
+        let dialog = document.getElementById('contact-dialog');
+        dialog.addEventListener('close', () => {
+            if (dialog.returnValue) contactSheet();
+        }, { once: true });
+        dialog.showModal();
+        return;
+    }
+
+    let query = new URLSearchParams();
+    for (let e of form.elements) {
+        if (e.name && e.value) query.append(e.name, e.value);
+    }
+
+    let dialog = document.getElementById('progress-dialog');
+    let progress = dialog.querySelector('progress');
+    progress.removeAttribute('value');
+    dialog.firstChild.textContent = 'Creating contact sheet…';
+    dialog.showModal();
+    try {
+        await restRequest('POST', '?contact&' + query, { progress: progress });
+    } catch (err) {
+        alertError('Contact sheet failed', err);
+    }
+    dialog.close();
+};
+
+window.describeFile = async state => {
+    let form = document.getElementById('describe-form');
+    if (state === 'dialog') {
+        form.reset();
+        loadKeywords();
+        // a single photo shows its metadata, a batch starts empty
+        if (photo) {
+            let d;
+            try {
+                d = await restRequest('GET', '?describe');
+            } catch (err) {
+                alertError('Load failed', err);
+                return;
+            }
+            for (let e of form.elements) {
+                if (!e.name) continue;
+                let val = d[e.name];
+                e.value = Array.isArray(val) ? val.join(', ') : val || '';
+            }
+        }
+        let dialog = document.getElementById('describe-dialog');
+        dialog.addEventListener('close', () => {
+            if (dialog.returnValue) describeFile();
+        }, { once: true });
+        dialog.showModal();
+        return;
+    }
+
+    let query = new URLSearchParams();
+    for (let e of form.elements) {
+        if (!e.name || !photo && e.value.trim() === '') continue;
+        if (e.name.endsWith('keywords')) {
+            let keywords = e.value.split(',').filter(k => k.trim());
+            for (let k of keywords) query.append(e.name, k);
+            if (keywords.length === 0) query.append(e.name, '');
+        } else {
+            query.append(e.name, e.value);
+        }
+    }
+
+    let dialog = document.getElementById('progress-dialog');
+    let progress = dialog.querySelector('progress');
+    progress.removeAttribute('value');
+    dialog.firstChild.textContent = 'Saving…';
+    dialog.showModal();
+    try {
+        await restRequest('POST', '?describe', { body: query, progress: progress });
+    } catch (err) {
+        alertError('Save failed', err);
+    }
+    dialog.close();
+};
+
+let savedTemplates = {};
+
+window.applyTemplate = async state => {
+    let form = document.getElementById('template-form');
+    if (state === 'dialog') {
+        await loadTemplates();
+        templateChange(form);
+        let dialog = document.getElementById('template-dialog');
+        dialog.addEventListener('close', () => {
+            if (dialog.returnValue) applyTemplate();
+        }, { once: true });
+        dialog.showModal();
+        return;
+    }
+
+    let query = templateQuery(form);
+    query.set('template', form.template.value);
+
+    let dialog = document.getElementById('progress-dialog');
+    let progress = dialog.querySelector('progress');
+    progress.removeAttribute('value');
+    dialog.firstChild.textContent = 'Applying template…';
+    dialog.showModal();
+    try {
+        await restRequest('POST', '?template', { body: query, progress: progress });
+    } catch (err) {
+        alertError('Apply failed', err);
+    }
+    dialog.close();
+};
+
+window.templateChange = form => {
+    let saved = savedTemplates[form.template.value];
+    for (let e of form.elements) {
+        if (!e.name || e.tagName === 'BUTTON' || e.name === 'template') continue;
+        if (saved) {
+            if (e.type === 'checkbox') e.checked = !!saved[e.name];
+            else e.value = saved[e.name] || '';
+        }
+        e.disabled = !!saved;
+    }
+    form.savetemplate.disabled = !!saved;
+    form.deltemplate.disabled = !saved;
+};
+
+window.saveTemplate = async form => {
+    let name = prompt('Save metadata template as:');
+    if (!name) return;
+
+    let query = templateQuery(form);
+    query.set('name', name);
+    try {
+        await restRequest('POST', '/template', { body: query });
+        await loadTemplates();
+        form.template.value = name;
+        templateChange(form);
+    } catch (err) {
+        alertError('Save failed', err);
+    }
+};
+
+window.deleteTemplate = async form => {
+    let name = form.template.value;
+    if (!name || !confirm(`Delete metadata template "${name}"?`)) return;
+
+    try {
+        await restRequest('DELETE', '/template?' + new URLSearchParams({ name }));
+        await loadTemplates();
+        templateChange(form);
+    } catch (err) {
+        alertError('Delete failed', err);
+    }
+};
+
+function templateQuery(form) {
+    let query = new URLSearchParams();
+    for (let e of form.elements) {
+        if (!e.name || e.disabled || e.name === 'template' || e.tagName === 'BUTTON') continue;
+        if (e.type === 'checkbox' ? e.checked : e.value.trim()) query.append(e.name, e.value);
+    }
+    return query;
+}
+
+async function loadTemplates() {
+    let form = document.getElementById('template-form');
+    try {
+        savedTemplates = await restRequest('GET', '/template');
+    } catch {
+        return;
+    }
+
+    let value = form.template.value;
+    for (let o of [...form.template.options]) {
+        if (o.value) o.remove();
+    }
+    for (let name of Object.keys(savedTemplates)) {
+        form.template.add(new Option(name, name));
+    }
+    form.template.value = value;
+    if (form.template.selectedIndex < 0) form.template.value = '';
+}
+
+let keywordList = [];
+
+async function loadKeywords() {
+    try {
+        keywordList = await restRequest('GET', '/keywords') ?? [];
+    } catch {
+        // autocomplete is optional
+    }
+}
+
+// Suggest keywords from the list for the last (comma separated) keyword being typed.
+document.getElementById('describe-form').addEventListener('input', evt => {
+    let input = evt.target;
+    if (!input.name || !input.name.endsWith('keywords')) return;
+
+    let i = input.value.lastIndexOf(',');
+    let prefix = i < 0 ? '' : input.value.substring(0, i + 1) + ' ';
+    let term = input.value.substring(i + 1).trim().toLowerCase();
+
+    let datalist = document.getElementById('keyword-list');
+    datalist.textContent = '';
+    if (!term) return;
+    let matches = keywordList.filter(k => k.split('|').some(name => name.toLowerCase().startsWith(term)));
+    for (let k of matches.slice(0, 20)) {
+        datalist.append(new Option(k, prefix + k));
+    }
+});
+
+window.importKeywords = () => {
+    let input = document.createElement('input');
+    input.type = 'file';
+    input.accept = '.txt,text/plain';
+    input.addEventListener('change', async () => {
+        if (!input.files.length) return;
+        let data = new FormData();
+        data.set('file', input.files[0]);
+        try {
+            await restRequest('POST', '/keywords', { body: data });
+            await loadKeywords();
+        } catch (err) {
+            alertError('Import failed', err);
+        }
+    });
+    input.click();
+};
+
+window.exportKeywords = () => {
+    let a = document.createElement('a');
+    a.href = '/keywords?export';
+    a.download = '';
+    a.click();
+};
+
+window.shiftTime = async state => {
+    let form = document.getElementById('timeshift-form');
+    if (state === 'dialog') {
+        form.reset();
+        timeShiftMode();
+        timeShiftTimes = {};
+        // show the current times
+        timeShiftPreview(await timeShiftRequest('GET', '?timeshift&offset=0:00'));
+        let dialog = document.getElementById('timeshift-dialog');
+        dialog.addEventListener('close', () => {
+            if (dialog.returnValue) shiftTime();
+        }, { once: true });
+        dialog.showModal();
+        return;
+    }
+
+    let query = new URLSearchParams();
+    for (let e of form.elements) {
+        if (e.name && e.name !== 'mode' && !e.disabled && (e.type !== 'checkbox' || e.checked)) query.append(e.name, e.value);
+    }
+
+    if (state === 'preview') {
+        timeShiftPreview(await timeShiftRequest('GET', '?timeshift&' + query));
+        return;
+    }
+
+    let dialog = document.getElementById('progress-dialog');
+    let progress = dialog.querySelector('progress');
+    progress.removeAttribute('value');
+    dialog.firstChild.textContent = 'Shifting capture times…';
+    dialog.showModal();
+    try {
+        await restRequest('POST', '?timeshift&' + query, { progress: progress });
+    } catch (err) {
+        alertError('Shift failed', err);
+    }
+    dialog.close();
+};
+
+window.geotagFiles = async state => {
+    let form = document.getElementById('geotag-form');
+    if (state === 'dialog') {
+        let dialog = document.getElementById('geotag-dialog');
+        dialog.addEventListener('close', () => {
+            if (dialog.returnValue) geotagFiles();
+        }, { once: true });
+        dialog.showModal();
+        return;
+    }
+
+    // options go in the query, an uploaded track in the body
+    let query = new URLSearchParams();
+    let data = new FormData();
+    for (let e of form.elements) {
+        if (!e.name) continue;
+        if (e.type === 'file') {
+            if (e.files.length) data.set(e.name, e.files[0]);
+        } else if (e.value && (e.type !== 'checkbox' || e.checked)) {
+            query.append(e.name, e.value);
+        }
+    }
+
+    let dialog = document.getElementById('progress-dialog');
+    let progress = dialog.querySelector('progress');
+    progress.removeAttribute('value');
+    dialog.firstChild.textContent = 'Geotagging…';
+    dialog.showModal();
+    try {
+        await restRequest('POST', '?geotag&' + query, { body: data, progress: progress });
+    } catch (err) {
+        alertError('Geotagging failed', err);
+    }
+    dialog.close();
+};
+
+window.geocodeFiles = async state => {
+    let form = document.getElementById('geocode-form');
+    if (state === 'dialog') {
+        let dialog = document.getElementById('geocode-dialog');
+        dialog.addEventListener('close', () => {
+            if (dialog.returnValue) geocodeFiles();
+        }, { once: true });
+        dialog.showModal();
+        return;
+    }
+
+    let query = new URLSearchParams();
+    if (form.overwrite.checked) query.set('overwrite', 'true');
+
+    let dialog = document.getElementById('progress-dialog');
+    let progress = dialog.querySelector('progress');
+    progress.removeAttribute('value');
+    dialog.firstChild.textContent = 'Filling in locations…';
+    dialog.showModal();
+    try {
+        await restRequest('POST', '?geocode&' + query, { progress: progress });
+    } catch (err) {
+        alertError('Locations failed', err);
+    }
+    dialog.close();
+};
+
+let timeShiftTimes = {};
+
+async function timeShiftRequest(method, url) {
+    try {
+        return await restRequest(method, url);
+    } catch (err) {
+        alertError('Preview failed', err);
+    }
+}
+
+function timeShiftPreview(preview) {
+    if (!preview) return;
+    let table = document.getElementById('timeshift-preview');
+    table.textContent = '';
+    for (let p of preview) {
+        let row = table.insertRow();
+        row.insertCell().textContent = p.name;
+        row.insertCell().textContent = p.old || 'No capture time';
+        row.insertCell().textContent = p.old ? '→' : '';
+        row.insertCell().textContent = p.new || '';
+        if (p.old && !(p.name in timeShiftTimes)) timeShiftTimes[p.name] = p.old;
+    }
+    timeShiftReference();
+}
+
+function timeShiftMode() {
+    let form = document.getElementById('timeshift-form');
+    let reference = form.mode.value === 'reference';
+    form.offset.disabled = reference;
+    form.reference.disabled = !reference;
+    form.time.disabled = !reference;
+}
+
+// Start from the current time of the reference photo.
+function timeShiftReference() {
+    let form = document.getElementById('timeshift-form');
+    let old = timeShiftTimes[form.reference.value];
+    if (old && !form.time.value) form.time.value = old.replace(' ', 'T').replace(/\..*/, '');
+}
+
+let timeShiftForm = document.getElementById('timeshift-form');
+if (timeShiftForm) {
+    timeShiftForm.addEventListener('change', evt => {
+        switch (evt.target.name) {
+            case 'mode':
+                timeShiftMode();
+                break;
+            case 'reference':
+                timeShiftForm.time.value = '';
+                timeShiftReference();
+                break;
+        }
+    });
+}
+
+window.moveFiles = state => filesAction('move', state);
+window.deleteFiles = state => filesAction('delete', state);
+
+async function filesAction(action, state) {
+    let form = document.getElementById('files-form');
+    if (state === 'dialog') {
+        let dest = document.getElementById('files-dest');
+        if (dest) {
+            dest.hidden = action !== 'move';
+            form.dest.disabled = action !== 'move';
+        }
+        document.getElementById('files-message').textContent = action === 'move'
+            ? 'Move these photos to another folder?'
+            : 'Delete these photos? This can’t be undone.';
+        let dialog = document.getElementById('files-dialog');
+        dialog.addEventListener('close', () => {
+            if (dialog.returnValue) filesAction(action);
+        }, { once: true });
+        dialog.showModal();
+        return;
+    }
+
+    let query = new URLSearchParams();
+    for (let e of form.elements) {
+        if (e.name && !e.disabled && (e.type !== 'checkbox' || e.checked)) query.append(e.name, e.value);
+    }
+
+    let dialog = document.getElementById('progress-dialog');
+    let progress = dialog.querySelector('progress');
+    progress.removeAttribute('value');
+    dialog.firstChild.textContent = action === 'move' ? 'Moving…' : 'Deleting…';
+    dialog.showModal();
+    try {
+        await restRequest('POST', `?${action}&` + query, { progress: progress });
+    } catch (err) {
+        alertError(action === 'move' ? 'Move failed' : 'Delete failed', err);
+    }
+    dialog.close();
+    location.reload();
+}
+
 window.printFile = () => {
     if (!print) return;
 
@@ -293,6 +742,114 @@ window.printFile = () => {
     }
 };
 
+window.addRendition = () => {
+    let div = document.getElementById('export-renditions');
+    let fieldset = document.createElement('fieldset');
+    fieldset.innerHTML = div.querySelector('template').innerHTML;
+    div.append(fieldset);
+};
+
+window.saveWatermark = async form => {
+    let name = prompt('Save watermark as:');
+    if (!name) return;
+
+    let data = new FormData();
+    data.set('name', name);
+    data.set('text', form.wmtext.value);
+    data.set('logo', form.wmfile.files[0] || form.wmlogo.value);
+    data.set('anchor', form.wmanchor.value);
+    data.set('opacity', form.wmopacity.value);
+    data.set('scale', form.wmscale.value);
+    data.set('margin', form.wmmargin.value);
+    try {
+        await restRequest('POST', '/watermark', { body: data });
+        await loadWatermarks();
+        form.watermark.value = name;
+        form.wmfile.value = '';
+        exportChange(form);
+    } catch (err) {
+        alertError('Save failed', err);
+    }
+};
+
+window.savePreset = async form => {
+    let name = prompt('Save export preset as:');
+    if (!name) return;
+
+    let query = exportQuery();
+    query.set('name', name);
+    try {
+        await restRequest('POST', '/preset?' + query);
+        await loadPresets();
+        form.preset.value = name;
+        exportChange(form);
+    } catch (err) {
+        alertError('Save failed', err);
+    }
+};
+
+window.deletePreset = async form => {
+    let name = form.preset.value;
+    if (!name || !confirm(`Delete export preset "${name}"?`)) return;
+
+    try {
+        await restRequest('DELETE', '/preset?' + new URLSearchParams({ name }));
+        await loadPresets();
+        exportChange(form);
+    } catch (err) {
+        alertError('Delete failed', err);
+    }
+};
+
+async function loadPresets() {
+    let form = document.getElementById('export-form');
+    let saved;
+    try {
+        saved = await restRequest('GET', '/preset');
+    } catch {
+        return;
+    }
+
+    let value = form.preset.value;
+    for (let o of [...form.preset.options]) {
+        if (o.value) o.remove();
+    }
+    for (let name of Object.keys(saved)) {
+        form.preset.add(new Option(name, name));
+    }
+    form.preset.value = value;
+    if (form.preset.selectedIndex < 0) form.preset.value = '';
+}
+
+async function loadWatermarks() {
+    let form = document.getElementById('export-form');
+    let saved;
+    try {
+        saved = await restRequest('GET', '/watermark');
+    } catch {
+        return;
+    }
+
+    let value = form.watermark.value;
+    for (let select of [form.watermark, form.wmlogo]) {
+        for (let o of [...select.options]) {
+            if (o.dataset.saved) o.remove();
+        }
+    }
+    for (let [name, wm] of Object.entries(saved)) {
+        let option = new Option(name, name);
+        option.dataset.saved = true;
+        form.watermark.add(option);
+        if (wm.logo === name) {
+            let option = new Option(name, name);
+            option.dataset.saved = true;
+            form.wmlogo.add(option);
+        }
+    }
+    form.watermark.value = value;
+    if (form.watermark.selectedIndex < 0) form.watermark.value = '';
+}
+
 window.toggleZoom = evt => {
     if (photo.style.cursor === 'crosshair') toggleWhite();
     let zoomed = photo.style.cursor === 'zoom-out';
@@ -326,8 +883,27 @@ window.showMeta = async () => {
 window.exportChange = e => {
     let form = e.tagName === 'FORM' ? e : e.form;
 
-    document.getElementById('export-jpeg').hidden = form.format.value !== 'JPEG';
-    document.getElementById('export-dng').hidden = form.format.value === 'JPEG';
+    // saved preset? hide everything else
+    let preset = form.preset.value !== '';
+    for (let div of form.children) {
+        if (div.id === 'export-preset' || div.id === 'export-dest' || div === form.lastElementChild) continue;
+        div.hidden = preset;
+    }
+    document.getElementById('export-dest').hidden = document.body.dataset.server === void 0;
+    form.savepreset.disabled = preset;
+    form.delpreset.disabled = !preset;
+
+    let dng = form.format.value.startsWith('DNG');
+    if (!preset) {
+        document.getElementById('export-jpeg').hidden = dng;
+        document.getElementById('export-dng').hidden = !dng;
+        document.getElementById('export-watermark').hidden = form.format.value === 'DNG';
+    }
+
+    // custom watermark?
+    for (let k of ['wmtext', 'wmlogo', 'wmfile', 'wmanchor', 'wmopacity', 'wmscale', 'wmmargin']) {
+        form[k].disabled = form.watermark.value !== '*';
+    }
 
     // density unit changed?
     let newden = form.denunit.value;
@@ -533,7 +1109,20 @@ function exportQuery(query) {
     if (query === void 0) query = new URLSearchParams();
 
     let form = document.getElementById('export-form');
-    if (form.format.value !== 'JPEG') {
+    if (form.dest.value && document.body.dataset.server !== void 0) {
+        query.set('dest', form.dest.value);
+    }
+    if (form.preset.value) {
+        query.set('preset', form.preset.value);
+        return query;
+    }
+    if (form.metadata.value) {
+        query.set('metadata', form.metadata.value);
+    }
+    if (form.filename.value) {
+        query.set('filename', form.filename.value);
+    }
+    if (form.format.value.startsWith('DNG')) {
         query.set('dng', '1');
         query.set('preview', form.preview.value);
         if (form.format.value === 'DNG+JPEG') {
@@ -542,17 +1131,57 @@ function exportQuery(query) {
         for (let k of ['lossy', 'embed']) {
             if (form[k].checked) query.set(k, '1');
         }
-    } else if (form.resample.checked) {
-        query.set('resample', '1');
-        for (let k of ['quality', 'fit', 'long', 'short', 'width', 'height', 'dimunit', 'density', 'denunit', 'mpixels']) {
-            if (form[k].value == 0) continue;
-            query.set(k, form[k].value);
+    } else {
+        if (form.format.value === 'TIFF') {
+            query.set('tiff', '1');
+        }
+        if (form.resample.checked) {
+            query.set('resample', '1');
+            for (let k of ['quality', 'fit', 'long', 'short', 'width', 'height', 'dimunit', 'density', 'denunit', 'mpixels']) {
+                if (form[k].value == 0) continue;
+                query.set(k, form[k].value);
+            }
+        }
+    }
+    let renditions = document.querySelectorAll('#export-renditions fieldset');
+    for (let i = 0; i < renditions.length; ++i) {
+        let r = renditions[i].elements;
+        let p = `renditions.${i}.`;
+        if (r.format.value === 'TIFF') query.set(p + 'tiff', '1');
+        if (r.suffix.value) query.set(p + 'suffix', r.suffix.value);
+        if (r.long.value > 0) {
+            query.set(p + 'resample', '1');
+            query.set(p + 'fit', 'dims');
+            query.set(p + 'dimunit', 'px');
+            query.set(p + 'long', r.long.value);
+            query.set(p + 'quality', form.quality.value);
+        }
+    }
+    if (form.format.value !== 'DNG') {
+        if (form.watermark.value === '*') {
+            for (let k of ['text', 'logo', 'anchor', 'opacity', 'scale', 'margin']) {
+                if (form['wm' + k].value == 0) continue;
+                query.set('watermark.' + k, form['wm' + k].value);
+            }
+        } else if (form.watermark.value) {
+            query.set('watermark.name', form.watermark.value);
         }
     }
 
     return query;
 }
 
+function showCulling({ rating, label, flag }) {
+    culling.dataset.rating = rating || 0;
+    culling.dataset.label = label || '';
+    culling.dataset.flag = flag || '';
+
+    let text = '★'.repeat(rating || 0);
+    if (label) text += ' ' + label;
+    if (flag) text += ' ' + (flag === 'pick' ? '⚑' : '✕');
+    culling.textContent = text;
+}
+
 function restRequest(method, url, { body, progress } = {}) {
     return new Promise((resolve, reject) => {
         let xhr = new XMLHttpRequest();
@@ -598,18 +1227,21 @@ function restRequest(method, url, { body, progress } = {}) {
                 }
             } else {
                 if (xhr.status === 207 && xhr.getResponseHeader('Content-Type') === 'application/x-ndjson') {
-                    let count = 0;
                     let lines = JSON.parseLines(xhr.responseText);
-                    for (let status of lines) {
-                        if (status.code >= 400) count++;
-                    }
-                    if (count === 0) {
+                    let failed = lines.filter(status => status.code >= 400);
+                    if (failed.length === 0) {
                         resolve(xhr.response);
                     } else {
+                        // name the photos that failed (the first few)
+                        let message = `${failed.length} of ${lines.length} operations failed.`;
+                        for (let status of failed.slice(0, 10)) {
+                            if (status.photo) message += `\n${status.photo}: ${status.response || status.text}`;
+                        }
+                        if (failed.length > 10) message += '\n…';
                         reject({
                             status: xhr.status,
                             name: xhr.statusText,
-                            message: `${count} of ${lines.length} operations failed.`,
+                            message: message,
                         });
                     }
                 } else if (xhr.status < 400) {
@@ -644,7 +1276,7 @@ function restRequest(method, url, { body, progress } = {}) {
                 }
             };
         }
-        if (body !== void 0) {
+        if (body !== void 0 && !(body instanceof FormData || body instanceof URLSearchParams)) {
             xhr.setRequestHeader('Content-Type', 'application/json');
             body = JSON.stringify(body);
         }
@@ -801,6 +1433,19 @@ if (photo) {
         }
     });
 
+    window.addEventListener('keydown', async evt => {
+        let query = cullingKey(evt, culling.dataset);
+        if (!query) return;
+        evt.preventDefault();
+
+        try {
+            await restRequest('POST', '?cull', { body: new URLSearchParams(query) });
+            showCulling(Object.assign({}, culling.dataset, query));
+        } catch (err) {
+            alertError('Culling failed', err);
+        }
+    });
+
     loadSettings();
 }
 
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"archive/zip"
 	"compress/flate"
 	"context"
 	"encoding/base64"
 	"io"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ncruces/rethinkraw/pkg/osutil"
 	"golang.org/x/sync/errgroup"
@@ -85,9 +91,15 @@ func findPhotos(batch []string) ([]batchPhoto, error) {
 	return photos, nil
 }
 
-func batchProcess(ctx context.Context, photos []batchPhoto, proc func(ctx context.Context, photo batchPhoto) error) <-chan error {
+// A batchResult is the outcome of processing a photo.
+type batchResult struct {
+	photo batchPhoto
+	err   error
+}
+
+func batchProcess(ctx context.Context, photos []batchPhoto, proc func(ctx context.Context, photo batchPhoto) error) <-chan batchResult {
 	const parallelism = 6
-	output := make(chan error, parallelism)
+	output := make(chan batchResult, parallelism)
 
 	go func() {
 		group, ctx := errgroup.WithContext(ctx)
@@ -95,7 +107,7 @@ func batchProcess(ctx context.Context, photos []batchPhoto, proc func(ctx contex
 		for _, photo := range photos {
 			photo := photo
 			group.Go(func() error {
-				output <- proc(ctx, photo)
+				output <- batchResult{photo, proc(ctx, photo)}
 				return nil
 			})
 		}
@@ -105,3 +117,109 @@ func batchProcess(ctx context.Context, photos []batchPhoto, proc func(ctx contex
 
 	return output
 }
+
+// A zipExport writes exported files to a ZIP archive, as they're done.
+// It's safe for concurrent use.
+type zipExport struct {
+	mtx      sync.Mutex
+	out      io.Writer
+	zip      *zip.Writer
+	names    map[string]struct{}
+	manifest []string
+}
+
+func newZIPExport(w io.Writer, total int) *zipExport {
+	return &zipExport{
+		out:      w,
+		zip:      zip.NewWriter(w),
+		names:    map[string]struct{}{},
+		manifest: make([]string, total),
+	}
+}
+
+// add adds the files exported from the photo with the given sequence number.
+func (z *zipExport) add(seq int, photo string, names []string, data [][]byte) error {
+	z.mtx.Lock()
+	defer z.mtx.Unlock()
+
+	var added []string
+	for i, name := range names {
+		name = z.uniqueName(filepath.ToSlash(name))
+		// exports are already compressed
+		f, err := z.zip.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Store,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data[i]); err != nil {
+			return err
+		}
+		added = append(added, name)
+	}
+	if err := z.zip.Flush(); err != nil {
+		return err
+	}
+	if f, ok := z.out.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	z.record(seq, "OK\t"+photo+"\t"+strings.Join(added, ", "))
+	return nil
+}
+
+// fail records an error for the photo with the given sequence number.
+func (z *zipExport) fail(seq int, photo string, err error) {
+	z.mtx.Lock()
+	defer z.mtx.Unlock()
+
+	_, msg := errorStatus(err)
+	msg = strings.Join(strings.Fields(msg), " ")
+	z.record(seq, "ERROR\t"+photo+"\t"+msg)
+}
+
+func (z *zipExport) record(seq int, line string) {
+	if 0 < seq && seq <= len(z.manifest) {
+		z.manifest[seq-1] = line
+	}
+}
+
+// close writes the manifest, and finishes the archive.
+func (z *zipExport) close() error {
+	z.mtx.Lock()
+	defer z.mtx.Unlock()
+
+	f, err := z.zip.CreateHeader(&zip.FileHeader{
+		Name:     z.uniqueName("manifest.txt"),
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	for _, line := range z.manifest {
+		if line == "" {
+			line = "SKIPPED"
+		}
+		if _, err := io.WriteString(f, line+"\r\n"); err != nil {
+			return err
+		}
+	}
+	return z.zip.Close()
+}
+
+// uniqueName avoids duplicate names in the archive,
+// by appending or incrementing a numeric suffix, like osutil.NewFile.
+func (z *zipExport) uniqueName(name string) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		if _, ok := z.names[name]; !ok {
+			z.names[name] = struct{}{}
+			return name
+		}
+		name = base + " (" + strconv.Itoa(i) + ")" + ext
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func Test_zipExport(t *testing.T) {
+	var buf bytes.Buffer
+	zw := newZIPExport(&buf, 3)
+	if err := zw.add(2, "b.CR2", []string{"b.jpg", "b_web.jpg"}, [][]byte{[]byte("B"), []byte("b")}); err != nil {
+		t.Fatal(err)
+	}
+	zw.fail(1, "a.CR2", errors.New("conversion\nfailed"))
+	if err := zw.add(3, "sub/b.CR2", []string{"sub/b.jpg", "b.jpg"}, [][]byte{[]byte("C"), []byte("c")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	var names []string
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, f.Name)
+		got[f.Name] = string(data)
+	}
+
+	wantNames := []string{"b.jpg", "b_web.jpg", "sub/b.jpg", "b (1).jpg", "manifest.txt"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("names = %q, want %q", names, wantNames)
+	}
+	if got["b (1).jpg"] != "c" {
+		t.Errorf(`"b (1).jpg" = %q, want "c"`, got["b (1).jpg"])
+	}
+	wantManifest := "" +
+		"ERROR\ta.CR2\tconversion failed\r\n" +
+		"OK\tb.CR2\tb.jpg, b_web.jpg\r\n" +
+		"OK\tsub/b.CR2\tsub/b.jpg, b (1).jpg\r\n"
+	if got["manifest.txt"] != wantManifest {
+		t.Errorf("manifest.txt = %q, want %q", got["manifest.txt"], wantManifest)
+	}
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ncruces/go-sqlite3/driver"
+	"github.com/ncruces/rethinkraw/pkg/osutil"
+)
+
+// The catalog is an optional database (enabled with -catalog) kept in DataDir as: "catalog.db".
+//
+// It has a row per photo, keyed by path, with metadata, culling, keywords,
+// and the edit flag, so galleries and searches don't need exiftool for every view.
+// Rows are validated by the size and modification time of the photo (and its sidecar),
+// and updated on demand, when photos are edited, culled or uploaded,
+// and by a background scanner that walks folders as they're browsed.
+
+var catalog *photoCatalog
+
+type photoCatalog struct {
+	db   *sql.DB
+	scan chan catalogScan
+}
+
+type catalogScan struct {
+	path      string
+	recursive bool
+}
+
+type catalogEntry struct {
+	Size     int64
+	ModTime  time.Time
+	XMPTime  time.Time // of the sidecar
+	Date     time.Time
+	Camera   string
+	Lens     string
+	ISO      float64
+	Focal    float64
+	Title    string
+	Caption  string
+	Keywords []string
+	Culling  culling
+	Edited   bool
+}
+
+// catalogVersion is the version of catalogSchema, kept as the user_version of the database.
+// The catalog can always be rebuilt from the photos,
+// so a catalog of any other version is dropped rather than migrated.
+const catalogVersion = 1
+
+const catalogSchema = `
+	CREATE TABLE IF NOT EXISTS photos (
+		path     TEXT PRIMARY KEY,
+		dir      TEXT NOT NULL,
+		size     INTEGER NOT NULL,
+		mtime    INTEGER NOT NULL,
+		xmptime  INTEGER NOT NULL,
+		date     INTEGER NOT NULL,
+		camera   TEXT NOT NULL,
+		lens     TEXT NOT NULL,
+		iso      REAL NOT NULL,
+		focal    REAL NOT NULL,
+		title    TEXT NOT NULL,
+		caption  TEXT NOT NULL,
+		keywords TEXT NOT NULL,
+		rating   INTEGER NOT NULL,
+		label    TEXT NOT NULL,
+		flag     TEXT NOT NULL,
+		edited   INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS photos_dir ON photos (dir);
+`
+
+func openCatalog(name string) (*photoCatalog, error) {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return nil, err
+	}
+	db, err := driver.Open("file:" + filepath.ToSlash(name) + "?_pragma=busy_timeout(10000)&_pragma=journal_mode(wal)")
+	if err != nil {
+		return nil, err
+	}
+	if err := upgradeCatalog(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &photoCatalog{db: db}, nil
+}
+
+func upgradeCatalog(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version == catalogVersion {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DROP TABLE IF EXISTS photos;` + catalogSchema +
+		`PRAGMA user_version = ` + strconv.Itoa(catalogVersion))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *photoCatalog) close() error {
+	return c.db.Close()
+}
+
+// get reads the rows of photos, which may be stale.
+func (c *photoCatalog) get(paths []string) (map[string]*catalogEntry, error) {
+	stmt, err := c.db.Prepare(`
+		SELECT size, mtime, xmptime, date, camera, lens, iso, focal,
+			title, caption, keywords, rating, label, flag, edited
+		FROM photos WHERE path = ?`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	res := make(map[string]*catalogEntry, len(paths))
+	for _, path := range paths {
+		var e catalogEntry
+		var mtime, xmptime, date int64
+		var keywords string
+		err := stmt.QueryRow(path).Scan(&e.Size, &mtime, &xmptime, &date,
+			&e.Camera, &e.Lens, &e.ISO, &e.Focal, &e.Title, &e.Caption, &keywords,
+			&e.Culling.Rating, &e.Culling.Label, &e.Culling.Flag, &e.Edited)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		e.ModTime = fromUnixNano(mtime)
+		e.XMPTime = fromUnixNano(xmptime)
+		e.Date = fromUnixNano(date)
+		json.Unmarshal([]byte(keywords), &e.Keywords)
+		res[path] = &e
+	}
+	return res, nil
+}
+
+// put writes the rows of photos.
+func (c *photoCatalog) put(entries map[string]*catalogEntry) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT OR REPLACE INTO photos (path, dir, size, mtime, xmptime, date, camera, lens, iso, focal,
+			title, caption, keywords, rating, label, flag, edited)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for path, e := range entries {
+		keywords, err := json.Marshal(e.Keywords)
+		if err != nil {
+			return err
+		}
+		_, err = stmt.Exec(path, filepath.Dir(path), e.Size,
+			unixNano(e.ModTime), unixNano(e.XMPTime), unixNano(e.Date),
+			e.Camera, e.Lens, e.ISO, e.Focal, e.Title, e.Caption, string(keywords),
+			e.Culling.Rating, e.Culling.Label, e.Culling.Flag, e.Edited)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// prune deletes the rows of photos in dir (not in subfolders) that aren't in keep.
+func (c *photoCatalog) prune(dir string, keep []string) error {
+	kept := make(map[string]struct{}, len(keep))
+	for _, path := range keep {
+		kept[path] = struct{}{}
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT path FROM photos WHERE dir = ?`, dir)
+	if err != nil {
+		return err
+	}
+	var gone []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			rows.Close()
+			return err
+		}
+		if _, ok := kept[path]; !ok {
+			gone = append(gone, path)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, path := range gone {
+		if _, err := tx.Exec(`DELETE FROM photos WHERE path = ?`, path); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// load returns up to date rows for photos, updating stale ones.
+// Photos that are gone are left out.
+func (c *photoCatalog) load(paths []string) (map[string]*catalogEntry, error) {
+	rows, err := c.get(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*catalogEntry, len(paths))
+	var stale []string
+	stats := map[string]catalogEntry{}
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		stat := catalogEntry{Size: fi.Size(), ModTime: fi.ModTime()}
+		if sidecar, _ := xmpSidecar(path); sidecar != "" {
+			if si, err := os.Stat(sidecar); err == nil {
+				stat.XMPTime = si.ModTime()
+			}
+		}
+
+		if e := rows[path]; e != nil && e.Size == stat.Size && e.ModTime.Equal(stat.ModTime) && e.XMPTime.Equal(stat.XMPTime) {
+			res[path] = e
+		} else {
+			stale = append(stale, path)
+			stats[path] = stat
+		}
+	}
+
+	const batch = 500
+	for chunk := range slices.Chunk(stale, batch) {
+		entries, err := queryCatalog(chunk)
+		if err != nil {
+			return nil, err
+		}
+		for path, e := range entries {
+			stat := stats[path]
+			e.Size, e.ModTime, e.XMPTime = stat.Size, stat.ModTime, stat.XMPTime
+			res[path] = e
+		}
+		if err := c.put(entries); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// queryCatalog reads the metadata of a batch of photos:
+// with exiftool, for the photo and its sidecar, and reading the sidecar for culling and edits.
+func queryCatalog(paths []string) (map[string]*catalogEntry, error) {
+	opts := []string{"-json", "-fast2", "-d", "%Y-%m-%dT%H:%M:%S",
+		"-DateTimeOriginal", "-SubSecTimeOriginal", "-Make", "-Model", "-LensModel", "-Lens", "-ISO#", "-FocalLength#",
+		"-XMP-dc:Subject", "-IPTC:Keywords", "-XMP-dc:Title", "-IPTC:ObjectName",
+		"-XMP-dc:Description", "-IPTC:Caption-Abstract", "-EXIF:ImageDescription"}
+
+	type fileMeta struct {
+		gallery *galleryMeta
+		search  *searchEntry
+	}
+	parse := func(out []byte) (map[string]fileMeta, error) {
+		metas, err := parseGalleryMeta(out)
+		if err != nil {
+			return nil, err
+		}
+		search, err := parseSearchMeta(out)
+		if err != nil {
+			return nil, err
+		}
+		res := make(map[string]fileMeta, len(metas))
+		for path, meta := range metas {
+			res[path] = fileMeta{meta, search[path]}
+		}
+		return res, nil
+	}
+
+	log.Printf("exiftool (catalog %d photos)...", len(paths))
+	files, err := queryExifJSON(paths, opts, parse)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*catalogEntry, len(paths))
+	for _, path := range paths {
+		var e catalogEntry
+		pair := files[path]
+		if meta := mergeGalleryMeta([2]*galleryMeta{pair[0].gallery, pair[1].gallery}); meta != nil {
+			e.Date = meta.Date
+			e.Camera = meta.Camera
+			e.Lens = meta.Lens
+			e.ISO = meta.ISO
+			e.Focal = meta.Focal
+		}
+		var s searchEntry
+		s.merge(pair[0].search)
+		s.merge(pair[1].search)
+		if data, err := readSidecar(path); err == nil && data != nil {
+			e.Edited = hasCameraRawSettings(bytes.NewReader(data))
+			e.Culling = parseCulling(data)
+		}
+		e.Title = s.Title
+		e.Caption = s.Caption
+		e.Keywords = s.Keywords
+		res[path] = &e
+	}
+	return res, nil
+}
+
+func (e *catalogEntry) galleryMeta() *galleryMeta {
+	return &galleryMeta{
+		Date:   e.Date,
+		Camera: e.Camera,
+		Lens:   e.Lens,
+		ISO:    e.ISO,
+		Focal:  e.Focal,
+	}
+}
+
+func (e *catalogEntry) searchEntry() *searchEntry {
+	return &searchEntry{
+		Keywords: e.Keywords,
+		Title:    e.Title,
+		Caption:  e.Caption,
+		Camera:   e.Camera,
+		Lens:     e.Lens,
+		Date:     e.Date,
+	}
+}
+
+// startScanner starts the background scanner.
+func (c *photoCatalog) startScanner() {
+	c.scan = make(chan catalogScan, 1000)
+	go func() {
+		for s := range c.scan {
+			if err := c.scanPath(s); err != nil {
+				log.Print("catalog: ", err)
+			}
+		}
+	}()
+}
+
+// scanPath updates the rows of a photo, or of the photos in a folder.
+func (c *photoCatalog) scanPath(s catalogScan) error {
+	fi, err := os.Stat(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		// a photo, or a folder of photos
+		_, err := c.db.Exec(`DELETE FROM photos WHERE path = ? OR dir = ?`, s.path, s.path)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		_, err := c.load([]string{s.path})
+		return err
+	}
+
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return err
+	}
+	var photos []string
+	for _, entry := range entries {
+		if osutil.HiddenFile(entry) {
+			continue
+		}
+		path := filepath.Join(s.path, entry.Name())
+		if entry.IsDir() {
+			if s.recursive {
+				if err := c.scanPath(catalogScan{path, true}); err != nil {
+					log.Print("catalog: ", err)
+				}
+			}
+			continue
+		}
+		if _, ok := extensions[strings.ToUpper(filepath.Ext(path))]; ok && entry.Type().IsRegular() {
+			photos = append(photos, path)
+		}
+	}
+	if err := c.prune(s.path, photos); err != nil {
+		return err
+	}
+	_, err = c.load(photos)
+	return err
+}
+
+// catalogUpdate asks the background scanner to update the rows of a photo (or folder).
+// It does nothing if the catalog is disabled, and never blocks:
+// rows that are missed are updated on demand anyway.
+func catalogUpdate(path string, recursive bool) {
+	if catalog == nil || catalog.scan == nil {
+		return
+	}
+	select {
+	case catalog.scan <- catalogScan{path, recursive}:
+	default:
+	}
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ncruces/go-sqlite3/driver"
+)
+
+func Test_photoCatalog(t *testing.T) {
+	dir := t.TempDir()
+	c, err := openCatalog(filepath.Join(dir, "catalog.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+
+	photo := filepath.Join(dir, "IMG_0001.CR3")
+	other := filepath.Join(dir, "IMG_0002.CR3")
+	if err := os.WriteFile(photo, []byte("raw"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := catalogEntry{
+		Size:     fi.Size(),
+		ModTime:  fi.ModTime(),
+		Date:     time.Date(2024, 5, 6, 7, 8, 9, 500_000_000, time.Local),
+		Camera:   "Canon EOS R5",
+		ISO:      400,
+		Focal:    100,
+		Title:    "Over the hill",
+		Keywords: []string{"Birds", "Red Kite"},
+		Culling:  culling{Rating: 4, Label: "Red", Flag: "pick"},
+		Edited:   true,
+	}
+	if err := c.put(map[string]*catalogEntry{photo: &entry, other: {}}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.get([]string{photo, other, filepath.Join(dir, "missing.CR3")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("get() = %d rows, want 2", len(got))
+	}
+	if !got[photo].Date.Equal(entry.Date) || !got[photo].ModTime.Equal(entry.ModTime) || !got[other].Date.IsZero() {
+		t.Errorf("get() = %v, want %v", got[photo], entry)
+	}
+	got[photo].Date, got[photo].ModTime = entry.Date, entry.ModTime
+	if !reflect.DeepEqual(*got[photo], entry) {
+		t.Errorf("get() = %v, want %v", got[photo], entry)
+	}
+
+	// fresh rows don't need exiftool
+	got, err = c.load([]string{photo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[photo] == nil || got[photo].Camera != entry.Camera {
+		t.Errorf("load() = %v, want %v", got[photo], entry)
+	}
+
+	if err := c.prune(dir, []string{photo}); err != nil {
+		t.Fatal(err)
+	}
+	got, err = c.get([]string{photo, other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[photo] == nil {
+		t.Errorf("prune() kept %v, want %s", got, photo)
+	}
+}
+
+func Test_openCatalog_upgrade(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "catalog.db")
+
+	// a catalog from before schema versions, with a thumb column
+	old := strings.Replace(catalogSchema, "edited   INTEGER NOT NULL", "edited INTEGER NOT NULL, thumb TEXT NOT NULL", 1)
+	db, err := driver.Open("file:" + filepath.ToSlash(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(old); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	c, err := openCatalog(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+
+	var version int
+	if err := c.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != catalogVersion {
+		t.Errorf("user_version = %d, want %d", version, catalogVersion)
+	}
+	if err := c.put(map[string]*catalogEntry{"/photos/IMG_0001.CR3": {Size: 1}}); err != nil {
+		t.Errorf("put() = %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Photos are compared by their EXIF, lens info, and develop settings (crs, from the sidecar),
+// to find out why photos from the same session render differently.
+// The reference is the first photo, unless another one is named: values that differ from it are highlighted.
+
+// compareLimit is the most photos compared at once.
+const compareLimit = 20
+
+var compareTags = []string{
+	"-EXIF:all", "--EXIF:ThumbnailImage", "--EXIF:PreviewImage",
+	"-Composite:LensID", "-Composite:Lens", "-Composite:LensSpec", "-XMP-aux:all",
+	"-XMP-crs:all",
+}
+
+type compareRow struct {
+	Tag     string   `json:"tag"` // as "ExifIFD:ISO"
+	Values  []string `json:"values"`
+	Differs []bool   `json:"differs"` // from the reference
+}
+
+// Same is true if all photos have the same value.
+func (r compareRow) Same() bool {
+	return !slices.Contains(r.Differs, true)
+}
+
+// compareReference moves the reference photo, named as in the batch, to the front.
+func compareReference(photos []batchPhoto, reference string) ([]batchPhoto, error) {
+	if reference == "" {
+		return photos, nil
+	}
+	i := slices.IndexFunc(photos, func(photo batchPhoto) bool {
+		return photo.Name == reference
+	})
+	if i < 0 {
+		return nil, fmt.Errorf("reference photo not in batch: %s", reference)
+	}
+	res := make([]batchPhoto, 0, len(photos))
+	res = append(res, photos[i])
+	res = append(res, photos[:i]...)
+	return append(res, photos[i+1:]...), nil
+}
+
+// compareMeta compares the metadata of photos.
+func compareMeta(paths []string) ([]compareRow, error) {
+	opts := append([]string{"-json", "-G1", "-fixBase"}, compareTags...)
+
+	log.Printf("exiftool (compare %d photos)...", len(paths))
+	metas, err := queryExifJSON(paths, opts, parseCompareMeta)
+	if err != nil {
+		return nil, err
+	}
+
+	// the sidecar prevails
+	photos := make([]map[string]string, len(paths))
+	for i, path := range paths {
+		photos[i] = map[string]string{}
+		for _, meta := range metas[path] {
+			maps.Copy(photos[i], meta)
+		}
+	}
+	return compareRows(photos), nil
+}
+
+func parseCompareMeta(out []byte) (map[string]map[string]string, error) {
+	files, err := parseExifJSON[map[string]json.RawMessage](out)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]map[string]string, len(files))
+	for path, f := range files {
+		meta := make(map[string]string, len(*f))
+		for k, raw := range *f {
+			if k == "SourceFile" {
+				continue
+			}
+			var val string
+			if err := json.Unmarshal(raw, &val); err != nil {
+				// numbers, lists and structures
+				val = string(raw)
+			}
+			if strings.HasPrefix(val, "(Binary data ") {
+				continue
+			}
+			meta[k] = val
+		}
+		res[path] = meta
+	}
+	return res, nil
+}
+
+// compareRows lines up the tags of photos, EXIF first, then lens info, then develop settings.
+func compareRows(photos []map[string]string) []compareRow {
+	var tags []string
+	for _, meta := range photos {
+		for tag := range meta {
+			tags = append(tags, tag)
+		}
+	}
+	slices.SortFunc(tags, func(a, b string) int {
+		return cmp.Or(cmp.Compare(compareRank(a), compareRank(b)), strings.Compare(a, b))
+	})
+	tags = slices.Compact(tags)
+
+	rows := make([]compareRow, len(tags))
+	for i, tag := range tags {
+		row := compareRow{
+			Tag:     tag,
+			Values:  make([]string, len(photos)),
+			Differs: make([]bool, len(photos)),
+		}
+		for j, meta := range photos {
+			row.Values[j] = meta[tag]
+			row.Differs[j] = row.Values[j] != row.Values[0]
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+func compareRank(tag string) int {
+	group, _, _ := strings.Cut(tag, ":")
+	switch group {
+	case "XMP-crs":
+		return 2
+	case "Composite", "XMP-aux":
+		return 1
+	default:
+		return 0
+	}
+}
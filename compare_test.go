@@ -0,0 +1,94 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func Test_parseCompareMeta(t *testing.T) {
+	out := []byte(`[{
+		"SourceFile": "dir/IMG_0001.CR3",
+		"ExifIFD:ISO": 400,
+		"ExifIFD:ExposureTime": "1/250",
+		"IFD1:ThumbnailImage": "(Binary data 8000 bytes, use -b option to extract)",
+		"Composite:LensID": "RF100-500mm F4.5-7.1 L IS USM"
+	}, {
+		"SourceFile": "dir/IMG_0001.xmp",
+		"XMP-crs:Exposure2012": "+0.50",
+		"XMP-crs:ToneCurvePV2012": ["0, 0", "255, 255"]
+	}]`)
+
+	got, err := parseCompareMeta(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]string{
+		filepath.FromSlash("dir/IMG_0001.CR3"): {
+			"ExifIFD:ISO":          "400",
+			"ExifIFD:ExposureTime": "1/250",
+			"Composite:LensID":     "RF100-500mm F4.5-7.1 L IS USM",
+		},
+		filepath.FromSlash("dir/IMG_0001.xmp"): {
+			"XMP-crs:Exposure2012":    "+0.50",
+			"XMP-crs:ToneCurvePV2012": `["0, 0", "255, 255"]`,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseCompareMeta() = %v, want %v", got, want)
+	}
+}
+
+func Test_compareRows(t *testing.T) {
+	photos := []map[string]string{
+		{"XMP-crs:Exposure2012": "+0.50", "Composite:LensID": "RF50mm F1.8 STM", "ExifIFD:ISO": "400"},
+		{"XMP-crs:Exposure2012": "+0.50", "Composite:LensID": "RF50mm F1.8 STM", "ExifIFD:ISO": "800"},
+		{"XMP-crs:Exposure2012": "+1.00", "Composite:LensID": "RF50mm F1.8 STM", "ExifIFD:ISO": "400"},
+		{"Composite:LensID": "RF50mm F1.8 STM", "ExifIFD:ISO": "400"},
+	}
+
+	got := compareRows(photos)
+	want := []compareRow{
+		{"ExifIFD:ISO", []string{"400", "800", "400", "400"}, []bool{false, true, false, false}},
+		{"Composite:LensID", []string{"RF50mm F1.8 STM", "RF50mm F1.8 STM", "RF50mm F1.8 STM", "RF50mm F1.8 STM"}, []bool{false, false, false, false}},
+		{"XMP-crs:Exposure2012", []string{"+0.50", "+0.50", "+1.00", ""}, []bool{false, false, true, true}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("compareRows() = %v, want %v", got, want)
+	}
+	if got[0].Same() || !got[1].Same() {
+		t.Errorf("Same() = %v, %v, want false, true", got[0].Same(), got[1].Same())
+	}
+}
+
+func Test_compareReference(t *testing.T) {
+	photos := []batchPhoto{{"a/1.CR3", "1.CR3"}, {"a/2.CR3", "2.CR3"}, {"a/3.CR3", "3.CR3"}}
+
+	tests := []struct {
+		reference string
+		want      []string
+		wantErr   bool
+	}{
+		{"", []string{"1.CR3", "2.CR3", "3.CR3"}, false},
+		{"1.CR3", []string{"1.CR3", "2.CR3", "3.CR3"}, false},
+		{"3.CR3", []string{"3.CR3", "1.CR3", "2.CR3"}, false},
+		{"4.CR3", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := compareReference(photos, tt.reference)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("compareReference(%q) error = %v, wantErr %v", tt.reference, err, tt.wantErr)
+		}
+		var names []string
+		for _, photo := range got {
+			names = append(names, photo.Name)
+		}
+		if !slices.Equal(names, tt.want) {
+			t.Errorf("compareReference(%q) = %q, want %q", tt.reference, names, tt.want)
+		}
+	}
+	if photos[0].Name != "1.CR3" {
+		t.Errorf("compareReference() modified photos = %v", photos)
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"strings"
+
+	"github.com/ncruces/go-image/resize"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Contact sheets are PDF proofs: pages with a grid of thumbnails and captions.
+//
+// Captions are templates with metadata variables, like {name} or {stars} (see photoMeta).
+// Thumbnails are the ones embedded in the RAW files, so they don't reflect edits.
+
+type contactSettings struct {
+	Page    string   // a4, letter
+	Columns int      // grid columns
+	Rows    int      // grid rows
+	Title   string   // printed on every page
+	Caption []string // a template for each line
+}
+
+func (cs *contactSettings) validate() error {
+	switch strings.ToLower(cs.Page) {
+	case "", "a4", "letter":
+	default:
+		return fmt.Errorf("invalid page size: %q", cs.Page)
+	}
+	if cs.Columns == 0 {
+		cs.Columns = 4
+	}
+	if cs.Rows == 0 {
+		cs.Rows = 5
+	}
+	if cs.Columns < 1 || cs.Columns > 10 || cs.Rows < 1 || cs.Rows > 12 {
+		return errors.New("invalid grid size: up to 10 columns and 12 rows")
+	}
+	if len(cs.Caption) > 4 {
+		return errors.New("invalid caption: up to 4 lines")
+	}
+	for _, line := range cs.Caption {
+		var meta photoMeta
+		if _, err := expandTemplate(line, meta.lookup); err != nil {
+			return fmt.Errorf("invalid caption: %w", err)
+		}
+	}
+	return nil
+}
+
+// A contactPhoto is a thumbnail and its caption.
+// A photo that failed to load has no thumbnail (see failedContactPhoto).
+type contactPhoto struct {
+	jpeg    []byte
+	size    image.Point
+	gray    bool
+	caption []string
+}
+
+// failedContactPhoto labels the blank cell of a photo that failed to load
+// with its name and the error, so the failure shows on the sheet.
+func failedContactPhoto(name string, err error) contactPhoto {
+	return contactPhoto{caption: []string{name, "Error: " + err.Error()}}
+}
+
+// Page layout, in points.
+const (
+	contactMargin  = 36
+	contactPadding = 4
+	contactTitle   = 24
+	contactFooter  = 16
+	contactLeading = 10
+	contactFont    = 8
+)
+
+func (cs *contactSettings) pageSize() (width, height float64) {
+	if strings.EqualFold(cs.Page, "letter") {
+		return 612, 792
+	}
+	return 595.28, 841.89
+}
+
+func (cs *contactSettings) cellSize() (width, height float64) {
+	pw, ph := cs.pageSize()
+	gh := ph - 2*contactMargin - contactFooter
+	if cs.Title != "" {
+		gh -= contactTitle
+	}
+	return (pw - 2*contactMargin) / float64(cs.Columns), gh / float64(cs.Rows)
+}
+
+// loadContactPhoto loads the thumbnail and caption for a photo.
+func loadContactPhoto(ctx context.Context, path string, cs contactSettings) (contactPhoto, error) {
+	var res contactPhoto
+	if len(cs.Caption) > 0 {
+		meta, err := loadPhotoMeta(path, findSidecar(path)...)
+		if err != nil {
+			return res, err
+		}
+		for _, line := range cs.Caption {
+			line, err := expandTemplate(line, meta.lookup)
+			if err != nil {
+				return res, err
+			}
+			res.caption = append(res.caption, line)
+		}
+	}
+
+	img, err := thumbImage(ctx, path)
+	if err != nil {
+		return res, err
+	}
+
+	// about 150 dpi
+	cw, ch := cs.cellSize()
+	size := uint(max(cw, ch) * 150 / 72)
+	img = resize.Thumbnail(size, size, img, resize.Lanczos2)
+
+	buf := bytes.Buffer{}
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return res, err
+	}
+	res.jpeg = buf.Bytes()
+	res.size = img.Bounds().Size()
+	res.gray = img.ColorModel() == color.GrayModel
+	return res, nil
+}
+
+// writeContactSheet writes a PDF with the photos laid out in a grid.
+func writeContactSheet(w io.Writer, cs contactSettings, photos []contactPhoto) error {
+	pw, ph := cs.pageSize()
+	cw, ch := cs.cellSize()
+	perPage := cs.Columns * cs.Rows
+	pages := max(1, (len(photos)+perPage-1)/perPage)
+
+	pdf := pdfWriter{w: w}
+	pdf.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	catalog := pdf.reserve()
+	tree := pdf.reserve()
+	font := pdf.reserve()
+
+	pdf.begin(font)
+	pdf.printf("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>\n")
+	pdf.end()
+
+	var kids []string
+	for p := range pages {
+		var content bytes.Buffer
+		var images []string
+
+		top := ph - contactMargin
+		if cs.Title != "" {
+			fmt.Fprintf(&content, "BT /F1 14 Tf %.2f %.2f Td %s Tj ET\n",
+				float64(contactMargin), top-16, pdfString(cs.Title))
+			top -= contactTitle
+		}
+		footer := fmt.Sprintf("%d / %d", p+1, pages)
+		fmt.Fprintf(&content, "BT /F1 %d Tf %.2f %.2f Td %s Tj ET\n",
+			contactFont, pw-contactMargin-float64(len(footer))*contactFont/2, float64(contactMargin), pdfString(footer))
+
+		for i := 0; i < perPage && p*perPage+i < len(photos); i++ {
+			photo := photos[p*perPage+i]
+			cx := contactMargin + float64(i%cs.Columns)*cw
+			cy := top - float64(i/cs.Columns+1)*ch
+
+			// the image box, above the caption
+			capH := float64(len(photo.caption) * contactLeading)
+			bx, by := cx+contactPadding, cy+contactPadding+capH
+			bw, bh := cw-2*contactPadding, ch-2*contactPadding-capH
+
+			if photo.jpeg == nil || bw <= 0 || bh <= 0 {
+				fmt.Fprintf(&content, "q 0.85 g %.2f %.2f %.2f %.2f re f Q\n", bx, by, max(0, bw), max(0, bh))
+			} else {
+				scale := min(bw/float64(photo.size.X), bh/float64(photo.size.Y))
+				iw, ih := scale*float64(photo.size.X), scale*float64(photo.size.Y)
+				ix, iy := bx+(bw-iw)/2, by+(bh-ih)/2
+
+				img := pdf.reserve()
+				name := fmt.Sprintf("Im%d", len(images))
+				images = append(images, fmt.Sprintf("/%s %d 0 R", name, img))
+				space := "/DeviceRGB"
+				if photo.gray {
+					space = "/DeviceGray"
+				}
+				pdf.stream(img, fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode",
+					photo.size.X, photo.size.Y, space), photo.jpeg)
+				fmt.Fprintf(&content, "q %.2f 0 0 %.2f %.2f %.2f cm /%s Do Q\n", iw, ih, ix, iy, name)
+			}
+
+			// captions are clipped to the cell
+			if len(photo.caption) > 0 {
+				fmt.Fprintf(&content, "q %.2f %.2f %.2f %.2f re W n BT /F1 %d Tf\n", cx, cy, cw, ch, contactFont)
+				for l, line := range photo.caption {
+					y := by - float64((l+1)*contactLeading) + 2
+					fmt.Fprintf(&content, "1 0 0 1 %.2f %.2f Tm %s Tj\n", bx, y, pdfString(line))
+				}
+				content.WriteString("ET Q\n")
+			}
+		}
+
+		stream := pdf.reserve()
+		pdf.stream(stream, "", content.Bytes())
+
+		page := pdf.reserve()
+		pdf.begin(page)
+		pdf.printf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Contents %d 0 R\n", tree, pw, ph, stream)
+		pdf.printf("   /Resources << /Font << /F1 %d 0 R >> /XObject << %s >> >> >>\n", font, strings.Join(images, " "))
+		pdf.end()
+		kids = append(kids, fmt.Sprintf("%d 0 R", page))
+	}
+
+	pdf.begin(tree)
+	pdf.printf("<< /Type /Pages /Count %d /Kids [%s] >>\n", len(kids), strings.Join(kids, " "))
+	pdf.end()
+
+	pdf.begin(catalog)
+	pdf.printf("<< /Type /Catalog /Pages %d 0 R >>\n", tree)
+	pdf.end()
+
+	return pdf.close(catalog)
+}
+
+// pdfWriter writes the objects of a PDF file, and then its cross-reference table.
+type pdfWriter struct {
+	w       io.Writer
+	pos     int64
+	offsets []int64
+	err     error
+}
+
+func (p *pdfWriter) printf(format string, args ...any) {
+	if p.err == nil {
+		var n int
+		n, p.err = fmt.Fprintf(p.w, format, args...)
+		p.pos += int64(n)
+	}
+}
+
+func (p *pdfWriter) write(data []byte) {
+	if p.err == nil {
+		var n int
+		n, p.err = p.w.Write(data)
+		p.pos += int64(n)
+	}
+}
+
+// reserve returns a new object number.
+func (p *pdfWriter) reserve() int {
+	p.offsets = append(p.offsets, 0)
+	return len(p.offsets)
+}
+
+func (p *pdfWriter) begin(id int) {
+	p.offsets[id-1] = p.pos
+	p.printf("%d 0 obj\n", id)
+}
+
+func (p *pdfWriter) end() {
+	p.printf("endobj\n")
+}
+
+func (p *pdfWriter) stream(id int, dict string, data []byte) {
+	p.begin(id)
+	p.printf("<< %s /Length %d >>\nstream\n", dict, len(data))
+	p.write(data)
+	p.printf("\nendstream\n")
+	p.end()
+}
+
+func (p *pdfWriter) close(root int) error {
+	xref := p.pos
+	p.printf("xref\n0 %d\n0000000000 65535 f \n", len(p.offsets)+1)
+	for _, o := range p.offsets {
+		p.printf("%010d 00000 n \n", o)
+	}
+	p.printf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(p.offsets)+1, root, xref)
+	return p.err
+}
+
+// pdfString encodes a string literal for the standard fonts.
+func pdfString(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('(')
+	for _, r := range s {
+		c, ok := charmap.Windows1252.EncodeRune(r)
+		switch {
+		case !ok:
+			buf.WriteByte('?')
+		case c == '(' || c == ')' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c < ' ':
+			buf.WriteByte(' ')
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte(')')
+	return buf.String()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func Test_pdfString(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{"", "()"},
+		{"IMG_0001", "(IMG_0001)"},
+		{"a (b) c\\d", `(a \(b\) c\\d)`},
+		{"line\nbreak", "(line break)"},
+		{"© 2024", "(\xa9 2024)"},
+		{"日本", "(??)"},
+	}
+	for _, tt := range tests {
+		if got := pdfString(tt.arg); got != tt.want {
+			t.Errorf("pdfString(%q) = %q, want %q", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func Test_writeContactSheet(t *testing.T) {
+	var thumb bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, 30, 20))
+	if err := jpeg.Encode(&thumb, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	photo := contactPhoto{jpeg: thumb.Bytes(), size: image.Pt(30, 20), caption: []string{"IMG_0001", "***"}}
+	failed := failedContactPhoto("IMG_0002", errors.New("unsupported file"))
+
+	cs := contactSettings{Columns: 2, Rows: 2, Title: "Proofs"}
+	if err := cs.validate(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeContactSheet(&buf, cs, []contactPhoto{photo, failed, photo, photo, photo}); err != nil {
+		t.Fatal(err)
+	}
+	pdf := buf.Bytes()
+
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatal("not a PDF file")
+	}
+	if n := bytes.Count(pdf, []byte("/Type /Page ")); n != 2 {
+		t.Errorf("got %d pages, want 2", n)
+	}
+	if n := bytes.Count(pdf, []byte("/Subtype /Image")); n != 4 {
+		t.Errorf("got %d images, want 4", n)
+	}
+	if !bytes.Contains(pdf, []byte("(Error: unsupported file) Tj")) {
+		t.Error("failed photo isn't labeled")
+	}
+
+	// every cross-reference points to its object
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	if m == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	if len(entries) == 0 {
+		t.Fatal("no xref entries")
+	}
+	for i, e := range entries {
+		offset, _ := strconv.Atoi(string(e[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(pdf[offset:], []byte(want)) {
+			t.Errorf("object %d not at offset %d", i+1, offset)
+		}
+	}
+}
+
+func Test_contactSettings_validate(t *testing.T) {
+	tests := []struct {
+		cs      contactSettings
+		wantErr bool
+	}{
+		{contactSettings{}, false},
+		{contactSettings{Page: "Letter", Columns: 3, Rows: 4}, false},
+		{contactSettings{Caption: []string{"{name}", "{date} {stars:*}"}}, false},
+		{contactSettings{Page: "A3"}, true},
+		{contactSettings{Columns: 11}, true},
+		{contactSettings{Rows: -1}, true},
+		{contactSettings{Caption: []string{"{nope}"}}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.cs.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("validate(%+v) = %v, wantErr %v", tt.cs, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ncruces/rethinkraw/pkg/xmp"
+)
+
+// Culling metadata is saved to the same sidecar as edits (see destSidecar):
+//  . a star rating, as xmp:Rating (0 to 5)
+//  . a color label, as xmp:Label
+//  . a pick/reject flag, as xmpDM:good (true/false)
+//
+// A xmp:Rating of -1 (rejected, for Lightroom and Bridge) is read as a reject flag,
+// and removed when the flag is changed.
+
+type culling struct {
+	Rating int    `json:"rating"`
+	Label  string `json:"label,omitempty"` // Red, Yellow, Green, Blue, Purple
+	Flag   string `json:"flag,omitempty"`  // pick, reject
+}
+
+var cullingLabels = []string{"Red", "Yellow", "Green", "Blue", "Purple"}
+
+var (
+	xmpRating = xml.Name{Space: "http://ns.adobe.com/xap/1.0/", Local: "Rating"}
+	xmpLabel  = xml.Name{Space: "http://ns.adobe.com/xap/1.0/", Local: "Label"}
+	xmpDMGood = xml.Name{Space: "http://ns.adobe.com/xmp/1.0/DynamicMedia/", Local: "good"}
+)
+
+func (c *culling) validate() error {
+	if c.Rating < 0 || c.Rating > 5 {
+		return fmt.Errorf("invalid rating: %d", c.Rating)
+	}
+	if c.Label != "" {
+		label, ok := cullingLabel(c.Label)
+		if !ok {
+			return fmt.Errorf("invalid label: %q", c.Label)
+		}
+		c.Label = label
+	}
+	switch c.Flag {
+	case "", "pick", "reject":
+	default:
+		return fmt.Errorf("invalid flag: %q", c.Flag)
+	}
+	return nil
+}
+
+func cullingLabel(label string) (string, bool) {
+	for _, l := range cullingLabels {
+		if strings.EqualFold(l, label) {
+			return l, true
+		}
+	}
+	return "", false
+}
+
+// loadCulling loads culling metadata from the sidecar of a photo,
+// or from the XMP embedded in an edited DNG.
+func loadCulling(path string) (culling, error) {
+	packet, err := readSidecar(path)
+	if err != nil {
+		return culling{}, err
+	}
+	return parseCulling(packet), nil
+}
+
+func parseCulling(packet []byte) (c culling) {
+	if len(packet) == 0 {
+		return c
+	}
+	props := xmp.GetProperties(bytes.NewReader(packet), xmpRating, xmpLabel, xmpDMGood)
+	if r, err := strconv.ParseFloat(props[xmpRating], 64); err == nil {
+		if r < 0 {
+			c.Flag = "reject"
+		} else {
+			c.Rating = min(5, int(r))
+		}
+	}
+	if l, ok := cullingLabel(props[xmpLabel]); ok {
+		c.Label = l
+	} else {
+		c.Label = props[xmpLabel]
+	}
+	switch strings.ToLower(props[xmpDMGood]) {
+	case "true":
+		c.Flag = "pick"
+	case "false":
+		c.Flag = "reject"
+	}
+	return c
+}
+
+// cullingArgs are the exiftool arguments to write the fields named in update.
+func cullingArgs(c culling, update ...string) []string {
+	var opts []string
+	for _, field := range update {
+		switch field {
+		case "rating":
+			if c.Rating == 0 {
+				opts = append(opts, "-XMP-xmp:Rating=")
+			} else {
+				opts = append(opts, "-XMP-xmp:Rating="+strconv.Itoa(c.Rating))
+			}
+		case "label":
+			opts = append(opts, "-XMP-xmp:Label="+c.Label)
+		case "flag":
+			switch c.Flag {
+			case "pick":
+				opts = append(opts, "-XMP-xmpDM:Good=true")
+			case "reject":
+				opts = append(opts, "-XMP-xmpDM:Good=false")
+			default:
+				opts = append(opts, "-XMP-xmpDM:Good=")
+			}
+			if c.Flag != "reject" && !slices.Contains(update, "rating") {
+				// a rating of -1 (as Lightroom rejects) is removed, but not others
+				opts = append(opts, "-XMP-xmp:Rating-=-1")
+			}
+		}
+	}
+	return opts
+}
+
+// saveCulling writes culling metadata to the sidecar of a photo.
+// Only the fields named in update are changed.
+func saveCulling(path string, c culling, update ...string) error {
+	dest, err := destSidecar(path)
+	if err != nil {
+		return err
+	}
+
+	opts := cullingArgs(c, update...)
+	if len(opts) == 0 {
+		return nil
+	}
+
+	if _, err := os.Stat(dest); errors.Is(err, fs.ErrNotExist) {
+		// a new sidecar
+		if ext := filepath.Ext(path); ext != "" {
+			opts = append(opts, "-XMP-photoshop:SidecarForExtension="+ext[1:])
+		}
+	} else if err != nil {
+		return err
+	}
+
+	opts = append(opts, "--printConv", "-overwrite_original", dest)
+	log.Print("exiftool (save culling)...")
+	_, err = exifserver.Command(opts...)
+	if err != nil {
+		return err
+	}
+	catalogUpdate(path, false)
+	return nil
+}
+
+// keepMetadata copies the metadata that's not an edit from a sidecar that's about to be replaced:
+// culling, descriptions (see saveDescription), metadata templates, shifted capture times, and geotags.
+func keepMetadata(from, to string) error {
+	if _, err := os.Stat(from); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	log.Print("exiftool (keep metadata)...")
+	_, err := exifserver.Command("--printConv", "-tagsFromFile", from,
+		"-XMP-xmp:Rating", "-XMP-xmp:Label", "-XMP-xmpDM:Good",
+		"-XMP-dc:Title", "-XMP-dc:Description", "-XMP-dc:Subject", "-XMP-lr:HierarchicalSubject",
+		"-XMP-dc:Creator", "-XMP-dc:Rights", "-XMP-xmpRights:all", "-XMP-iptcCore:CreatorContactInfo",
+		"-XMP-photoshop:City", "-XMP-photoshop:State", "-XMP-photoshop:Country",
+		"-XMP-exif:DateTimeOriginal", "-XMP-xmp:CreateDate", "-XMP-exif:GPS*",
+		"-overwrite_original", to)
+	return err
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ncruces/go-exiftool"
+)
+
+func Test_parseCulling(t *testing.T) {
+	const packet = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:xmpDM="http://ns.adobe.com/xmp/1.0/DynamicMedia/"
+   %s>
+   %s
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+	tests := []struct {
+		attrs, elems string
+		want         culling
+	}{
+		{"", "", culling{}},
+		{`xmp:Rating="3"`, "", culling{Rating: 3}},
+		{`xmp:Rating="-1"`, "", culling{Flag: "reject"}},
+		{`xmp:Rating="7"`, "", culling{Rating: 5}},
+		{`xmp:Label="red"`, "", culling{Label: "Red"}},
+		{`xmp:Label="To Do"`, "", culling{Label: "To Do"}},
+		{`xmpDM:good="True"`, "", culling{Flag: "pick"}},
+		{`xmpDM:good="false"`, "", culling{Flag: "reject"}},
+		{"", "<xmp:Rating>4</xmp:Rating><xmp:Label>Green</xmp:Label>", culling{Rating: 4, Label: "Green"}},
+	}
+	for _, tt := range tests {
+		data := []byte(fmt.Sprintf(packet, tt.attrs, tt.elems))
+		if got := parseCulling(data); got != tt.want {
+			t.Errorf("parseCulling(%q, %q) = %v, want %v", tt.attrs, tt.elems, got, tt.want)
+		}
+	}
+	if got := parseCulling(nil); got != (culling{}) {
+		t.Errorf("parseCulling(nil) = %v, want zero", got)
+	}
+}
+
+func Test_culling_validate(t *testing.T) {
+	tests := []struct {
+		in      culling
+		want    culling
+		wantErr bool
+	}{
+		{culling{}, culling{}, false},
+		{culling{Rating: 5, Label: "blue", Flag: "pick"}, culling{Rating: 5, Label: "Blue", Flag: "pick"}, false},
+		{culling{Rating: 6}, culling{}, true},
+		{culling{Rating: -1}, culling{}, true},
+		{culling{Label: "Orange"}, culling{}, true},
+		{culling{Flag: "maybe"}, culling{}, true},
+	}
+	for _, tt := range tests {
+		c := tt.in
+		err := c.validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validate(%v) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+		} else if err == nil && c != tt.want {
+			t.Errorf("validate(%v) = %v, want %v", tt.in, c, tt.want)
+		}
+	}
+}
+
+func Test_cullingArgs(t *testing.T) {
+	tests := []struct {
+		c      culling
+		update []string
+		want   []string
+	}{
+		{culling{Rating: 3}, nil, nil},
+		{culling{Rating: 3}, []string{"rating"}, []string{"-XMP-xmp:Rating=3"}},
+		{culling{}, []string{"rating", "label"}, []string{"-XMP-xmp:Rating=", "-XMP-xmp:Label="}},
+		{culling{Flag: "reject"}, []string{"flag"}, []string{"-XMP-xmpDM:Good=false"}},
+		{culling{Flag: "pick"}, []string{"flag"}, []string{"-XMP-xmpDM:Good=true", "-XMP-xmp:Rating-=-1"}},
+		{culling{}, []string{"flag"}, []string{"-XMP-xmpDM:Good=", "-XMP-xmp:Rating-=-1"}},
+		{culling{Rating: 2}, []string{"rating", "flag"}, []string{"-XMP-xmp:Rating=2", "-XMP-xmpDM:Good="}},
+	}
+	for _, tt := range tests {
+		if got := cullingArgs(tt.c, tt.update...); !slices.Equal(got, tt.want) {
+			t.Errorf("cullingArgs(%v, %q) = %q, want %q", tt.c, tt.update, got, tt.want)
+		}
+	}
+}
+
+func Test_keepMetadata(t *testing.T) {
+	exe, err := exec.LookPath("exiftool")
+	if err != nil {
+		t.Skip("exiftool not found")
+	}
+	exiftool.Exec = exe
+	if _, err := setupExifTool(); err != nil {
+		t.Fatal(err)
+	}
+	defer exifserver.Shutdown()
+
+	dir := t.TempDir()
+	from := filepath.Join(dir, "from.xmp")
+	to := filepath.Join(dir, "to.xmp")
+	_, err = exifserver.Command("-XMP-xmp:Rating=3", "-XMP-dc:Title=Kites",
+		"-XMP-lr:HierarchicalSubject=Animals|Birds", "-XMP-xmpRights:WebStatement=https://example.com",
+		"-XMP-exif:DateTimeOriginal=2024:05:06 07:08:09", from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exifserver.Command("-XMP-crs:Exposure2012=+1.0", to); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := keepMetadata(from, to); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exifserver.Command("-short", "-XMP:all", to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Rating", "Title", "HierarchicalSubject", "WebStatement", "DateTimeOriginal", "Exposure2012"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("keepMetadata() lost %s: %s", want, out)
+		}
+	}
+
+	// nothing to keep
+	if err := keepMetadata(filepath.Join(dir, "none.xmp"), to); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(to); err != nil {
+		t.Error(err)
+	}
+}
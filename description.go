@@ -0,0 +1,274 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"html"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Descriptive metadata (IPTC Core, as XMP) is saved to the same sidecar as edits (see destSidecar):
+//  . a title and caption, as dc:title and dc:description
+//  . keywords, as dc:subject and lr:hierarchicalSubject (see keywordSubjects)
+//  . a creator, copyright notice and usage terms, as dc:creator, dc:rights and xmpRights:UsageTerms
+//  . a location, as photoshop:City, photoshop:State and photoshop:Country
+//
+// It's loaded from the sidecar, falling back to the photo itself
+// (for the IPTC and EXIF some cameras and apps write).
+// A cleared field is saved as an empty value, rather than deleted,
+// so it doesn't fall back to the photo.
+
+type description struct {
+	Title      string   `json:"title"`
+	Caption    string   `json:"caption"`
+	Keywords   []string `json:"keywords"`
+	Creator    string   `json:"creator"`
+	Copyright  string   `json:"copyright"`
+	UsageTerms string   `json:"usageterms"`
+	City       string   `json:"city"`
+	State      string   `json:"state"`
+	Country    string   `json:"country"`
+
+	set map[string]bool // fields that have a value, even if empty (by descriptionFields name)
+}
+
+var descriptionFields = []string{"title", "caption", "keywords", "creator", "copyright", "usageterms", "city", "state", "country"}
+
+// clean trims fields, and removes empty and duplicate keywords.
+func (d *description) clean() {
+	for _, s := range []*string{&d.Title, &d.Caption, &d.Creator, &d.Copyright, &d.UsageTerms, &d.City, &d.State, &d.Country} {
+		*s = strings.TrimSpace(strings.ReplaceAll(*s, "\r\n", "\n"))
+	}
+	var keywords []string
+	for _, k := range d.Keywords {
+		var names []string
+		for _, name := range strings.Split(k, "|") {
+			if name = strings.Join(strings.Fields(name), " "); name != "" {
+				names = append(names, name)
+			}
+		}
+		k = strings.Join(names, "|")
+		if k != "" && !slices.Contains(keywords, k) {
+			keywords = append(keywords, k)
+		}
+	}
+	d.Keywords = keywords
+}
+
+// merge takes metadata from src, which prevails where it has a field, even an empty one.
+func (d *description) merge(src *description) {
+	if src == nil {
+		return
+	}
+	take := func(field string, dst *string, src *description, val string) {
+		if val != "" || src.set[field] {
+			*dst = val
+		}
+	}
+	take("title", &d.Title, src, src.Title)
+	take("caption", &d.Caption, src, src.Caption)
+	take("creator", &d.Creator, src, src.Creator)
+	take("copyright", &d.Copyright, src, src.Copyright)
+	take("usageterms", &d.UsageTerms, src, src.UsageTerms)
+	take("city", &d.City, src, src.City)
+	take("state", &d.State, src, src.State)
+	take("country", &d.Country, src, src.Country)
+	if len(src.Keywords) > 0 || src.set["keywords"] {
+		d.Keywords = src.Keywords
+	}
+}
+
+// loadDescription loads descriptive metadata for a photo.
+func loadDescription(path string) (d description, err error) {
+	opts := []string{"-json", "-fast2",
+		"-XMP-dc:Title", "-IPTC:ObjectName",
+		"-XMP-dc:Description", "-IPTC:Caption-Abstract", "-EXIF:ImageDescription",
+		"-XMP-dc:Subject", "-XMP-lr:HierarchicalSubject", "-IPTC:Keywords",
+		"-XMP-dc:Creator", "-IPTC:By-line", "-EXIF:Artist",
+		"-XMP-dc:Rights", "-IPTC:CopyrightNotice", "-EXIF:Copyright",
+		"-XMP-xmpRights:UsageTerms",
+		"-XMP-photoshop:City", "-IPTC:City",
+		"-XMP-photoshop:State", "-IPTC:Province-State",
+		"-XMP-photoshop:Country", "-IPTC:Country-PrimaryLocationName"}
+
+	log.Print("exiftool (load description)...")
+	res, err := queryExifJSON([]string{path}, opts, parseDescription)
+	if err != nil {
+		return d, err
+	}
+	for _, file := range res[path] {
+		d.merge(file)
+	}
+	return d, nil
+}
+
+// descriptionJSONTags are the exiftool JSON names of the tags of each field.
+var descriptionJSONTags = map[string][]string{
+	"title":      {"Title", "ObjectName"},
+	"caption":    {"Description", "Caption-Abstract", "ImageDescription"},
+	"keywords":   {"Subject", "HierarchicalSubject", "Keywords"},
+	"creator":    {"Creator", "By-line", "Artist"},
+	"copyright":  {"Rights", "CopyrightNotice", "Copyright"},
+	"usageterms": {"UsageTerms"},
+	"city":       {"City"},
+	"state":      {"State", "Province-State"},
+	"country":    {"Country", "Country-PrimaryLocationName"},
+}
+
+func parseDescription(out []byte) (map[string]*description, error) {
+	files, err := parseExifJSON[struct {
+		Title, ObjectName                  jsonString
+		Description, ImageDescription      jsonString
+		CaptionAbstract                    jsonString `json:"Caption-Abstract"`
+		Subject, Keywords                  jsonStrings
+		HierarchicalSubject                jsonStrings
+		Creator                            jsonStrings
+		ByLine                             jsonStrings `json:"By-line"`
+		Artist                             jsonString
+		Rights, CopyrightNotice, Copyright jsonString
+		UsageTerms                         jsonString
+		City, State, Country               jsonString
+		ProvinceState                      jsonString `json:"Province-State"`
+		CountryName                        jsonString `json:"Country-PrimaryLocationName"`
+	}](out)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := parseExifJSON[map[string]json.RawMessage](out)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*description, len(files))
+	for path, f := range files {
+		creator := f.Creator
+		if len(creator) == 0 {
+			creator = f.ByLine
+		}
+		d := description{
+			Title:      string(cmp.Or(f.Title, f.ObjectName)),
+			Caption:    string(cmp.Or(f.Description, f.CaptionAbstract, f.ImageDescription)),
+			Keywords:   joinKeywords(f.Subject, f.HierarchicalSubject),
+			Creator:    cmp.Or(strings.Join(creator, "; "), string(f.Artist)),
+			Copyright:  string(cmp.Or(f.Rights, f.CopyrightNotice, f.Copyright)),
+			UsageTerms: string(f.UsageTerms),
+			City:       string(f.City),
+			State:      string(cmp.Or(f.State, f.ProvinceState)),
+			Country:    string(cmp.Or(f.Country, f.CountryName)),
+		}
+		if len(d.Keywords) == 0 {
+			d.Keywords = f.Keywords
+		}
+		d.clean()
+		for field, names := range descriptionJSONTags {
+			for _, name := range names {
+				if _, ok := (*tags[path])[name]; ok {
+					if d.set == nil {
+						d.set = map[string]bool{}
+					}
+					d.set[field] = true
+				}
+			}
+		}
+		res[path] = &d
+	}
+	return res, nil
+}
+
+// saveDescription writes descriptive metadata to the sidecar of a photo.
+// Only the fields named in update are changed.
+func saveDescription(path string, d description, update ...string) error {
+	log.Print("exiftool (save description)...")
+	return writeSidecar(path, descriptionArgs(d, update...))
+}
+
+// writeSidecar writes tags to the sidecar of a photo (see destSidecar).
+// Values must be escaped with exifEscape.
+func writeSidecar(path string, opts []string) error {
+	if len(opts) == 0 {
+		return nil
+	}
+
+	dest, err := destSidecar(path)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dest); errors.Is(err, fs.ErrNotExist) {
+		// a new sidecar
+		if ext := filepath.Ext(path); ext != "" {
+			opts = append(opts, "-XMP-photoshop:SidecarForExtension="+ext[1:])
+		}
+	} else if err != nil {
+		return err
+	}
+
+	// -E, so values can have line breaks
+	opts = append(opts, "-E", "-overwrite_original", dest)
+	_, err = exifserver.Command(opts...)
+	if err != nil {
+		return err
+	}
+	catalogUpdate(path, false)
+	return nil
+}
+
+func descriptionArgs(d description, update ...string) []string {
+	// clearing a field writes an empty value (^=), as deleting it would
+	// make loadDescription fall back to the photo
+	tag := func(name, value string) string {
+		if value == "" {
+			return "-" + name + "^="
+		}
+		return "-" + name + "=" + exifEscape(value)
+	}
+
+	var opts []string
+	for _, field := range update {
+		switch field {
+		case "title":
+			opts = append(opts, tag("XMP-dc:Title", d.Title))
+		case "caption":
+			opts = append(opts, tag("XMP-dc:Description", d.Caption))
+		case "keywords":
+			subjects, hierarchical := keywordSubjects(d.Keywords)
+			if len(subjects) == 0 {
+				opts = append(opts, tag("XMP-dc:Subject", ""))
+			}
+			if len(hierarchical) == 0 {
+				opts = append(opts, tag("XMP-lr:HierarchicalSubject", ""))
+			}
+			// assigning a list replaces it
+			for _, s := range subjects {
+				opts = append(opts, tag("XMP-dc:Subject", s))
+			}
+			for _, h := range hierarchical {
+				opts = append(opts, tag("XMP-lr:HierarchicalSubject", h))
+			}
+		case "creator":
+			opts = append(opts, tag("XMP-dc:Creator", d.Creator))
+		case "copyright":
+			opts = append(opts, tag("XMP-dc:Rights", d.Copyright))
+		case "usageterms":
+			opts = append(opts, tag("XMP-xmpRights:UsageTerms", d.UsageTerms))
+		case "city":
+			opts = append(opts, tag("XMP-photoshop:City", d.City))
+		case "state":
+			opts = append(opts, tag("XMP-photoshop:State", d.State))
+		case "country":
+			opts = append(opts, tag("XMP-photoshop:Country", d.Country))
+		}
+	}
+	return opts
+}
+
+// exifEscape escapes a value for exiftool -E,
+// as arguments can't have line breaks.
+func exifEscape(s string) string {
+	return strings.ReplaceAll(html.EscapeString(s), "\n", "&#xa;")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func Test_parseDescription(t *testing.T) {
+	out := []byte(`[{
+		"SourceFile": "dir/IMG_0001.CR3",
+		"ObjectName": "Over the hill",
+		"Caption-Abstract": "A kite, hunting",
+		"Keywords": "Birds",
+		"By-line": ["Jane Doe", "John Doe"],
+		"Copyright": "© 2024 Jane Doe",
+		"City": "Lisbon",
+		"Province-State": "Lisboa",
+		"Country-PrimaryLocationName": "Portugal"
+	}, {
+		"SourceFile": "dir/IMG_0002.CR3.xmp",
+		"Title": 2024,
+		"Description": " Line 1\r\nLine 2 ",
+		"Subject": ["Animals", "Birds", " Red  Kite", "Birds", "", "Lisbon"],
+		"HierarchicalSubject": "Animals|Birds| Red  Kite",
+		"Creator": "Jane Doe",
+		"Artist": "Ignored",
+		"UsageTerms": "All rights reserved"
+	}]`)
+
+	got, err := parseDescription(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]*description{
+		filepath.FromSlash("dir/IMG_0001.CR3"): {
+			Title:     "Over the hill",
+			Caption:   "A kite, hunting",
+			Keywords:  []string{"Birds"},
+			Creator:   "Jane Doe; John Doe",
+			Copyright: "© 2024 Jane Doe",
+			City:      "Lisbon",
+			State:     "Lisboa",
+			Country:   "Portugal",
+			set: map[string]bool{"title": true, "caption": true, "keywords": true, "creator": true,
+				"copyright": true, "city": true, "state": true, "country": true},
+		},
+		filepath.FromSlash("dir/IMG_0002.CR3.xmp"): {
+			Title:      "2024",
+			Caption:    "Line 1\nLine 2",
+			Keywords:   []string{"Animals|Birds|Red Kite", "Lisbon"},
+			Creator:    "Jane Doe",
+			UsageTerms: "All rights reserved",
+			set: map[string]bool{"title": true, "caption": true, "keywords": true, "creator": true,
+				"usageterms": true},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDescription() = %v, want %v", got, want)
+	}
+}
+
+func Test_description_merge(t *testing.T) {
+	d := description{Title: "Photo", Creator: "Camera", Keywords: []string{"a"}}
+	d.merge(&description{Title: "Sidecar", Country: "Portugal"})
+	d.merge(nil)
+	want := description{Title: "Sidecar", Creator: "Camera", Country: "Portugal", Keywords: []string{"a"}}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("merge() = %v, want %v", d, want)
+	}
+
+	// cleared in the sidecar
+	out := []byte(`[{"SourceFile": "a.xmp", "Title": "", "Subject": ""}]`)
+	cleared, err := parseDescription(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.merge(cleared["a.xmp"])
+	want = description{Creator: "Camera", Country: "Portugal"}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("merge() = %v, want %v", d, want)
+	}
+}
+
+func Test_descriptionArgs(t *testing.T) {
+	d := description{
+		Title:    `Kites & "eagles"`,
+		Caption:  "Line 1\nLine 2",
+		Keywords: []string{"Animals|Birds|Red Kite", "Lisbon"},
+	}
+
+	tests := []struct {
+		update []string
+		want   []string
+	}{
+		{nil, nil},
+		{[]string{"title"}, []string{"-XMP-dc:Title=Kites &amp; &#34;eagles&#34;"}},
+		{[]string{"caption", "city"}, []string{"-XMP-dc:Description=Line 1&#xa;Line 2", "-XMP-photoshop:City^="}},
+		{[]string{"keywords"}, []string{
+			"-XMP-dc:Subject=Animals", "-XMP-dc:Subject=Birds", "-XMP-dc:Subject=Red Kite", "-XMP-dc:Subject=Lisbon",
+			"-XMP-lr:HierarchicalSubject=Animals|Birds|Red Kite", "-XMP-lr:HierarchicalSubject=Lisbon"}},
+	}
+	for _, tt := range tests {
+		if got := descriptionArgs(d, tt.update...); !slices.Equal(got, tt.want) {
+			t.Errorf("descriptionArgs(%q) = %q, want %q", tt.update, got, tt.want)
+		}
+	}
+
+	if got := descriptionArgs(description{}, "keywords"); !slices.Equal(got, []string{"-XMP-dc:Subject^=", "-XMP-lr:HierarchicalSubject^="}) {
+		t.Errorf("descriptionArgs(keywords) = %q, want to clear", got)
+	}
+}
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"image"
 	"io/fs"
 	"math"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/ncruces/rethinkraw/pkg/osutil"
@@ -66,7 +68,18 @@ func saveEdit(ctx context.Context, path string, xmp xmpSettings) error {
 	if err != nil {
 		return err
 	}
-	return os.Rename(dest+".bak", dest)
+
+	// culling, descriptive and copyright metadata are saved separately
+	err = keepMetadata(dest, dest+".bak")
+	if err != nil {
+		return err
+	}
+	err = os.Rename(dest+".bak", dest)
+	if err != nil {
+		return err
+	}
+	catalogUpdate(path, false)
+	return nil
 }
 
 func previewEdit(ctx context.Context, path string, size int, xmp xmpSettings) ([]byte, error) {
@@ -125,7 +138,21 @@ func previewEdit(ctx context.Context, path string, size int, xmp xmpSettings) ([
 	}
 }
 
+// exportEdit exports a photo that has no other renditions.
 func exportEdit(ctx context.Context, path string, xmp xmpSettings, exp exportSettings) ([]byte, error) {
+	out, err := exportEdits(ctx, path, xmp, exp)
+	if err != nil {
+		return nil, err
+	}
+	return out[0], nil
+}
+
+// exportEdits exports a photo, and its renditions (see exportSettings.renditions),
+// from a single Adobe DNG Converter run.
+//
+// Other renditions are made from a full size preview, so a DNG that has them
+// always embeds one: the DNG is bigger than asked for, but it's converted only once.
+func exportEdits(ctx context.Context, path string, xmp xmpSettings, exp exportSettings) ([][]byte, error) {
 	wk, err := openWorkspace(path)
 	if err != nil {
 		return nil, err
@@ -141,46 +168,201 @@ func exportEdit(ctx context.Context, path string, xmp xmpSettings, exp exportSet
 		return nil, err
 	}
 
-	err = runDNGConverter(ctx, wk.orig(), wk.temp(), 0, &exp)
+	renditions := exp.renditions()
+	conv := exp
+	if conv.DNG && len(renditions) > 1 {
+		conv.Preview = "p2"
+	}
+	err = runDNGConverter(ctx, wk.orig(), wk.temp(), 0, &conv)
 	if err != nil {
 		return nil, err
 	}
 
-	if exp.DNG {
-		err = fixMetaDNG(wk.orig(), wk.temp(), path)
+	var data []byte
+	var res [][]byte
+	for _, r := range renditions {
+		var out []byte
+		if r.DNG {
+			err = fixMetaDNG(wk.orig(), wk.temp(), path, r.metaPolicy())
+			if err != nil {
+				return nil, err
+			}
+			out, err = os.ReadFile(wk.temp())
+		} else {
+			if data == nil {
+				data, err = exportJPEG(ctx, wk.temp())
+				if err != nil {
+					return nil, err
+				}
+			}
+			out, err = exportImage(&wk, path, data, r)
+		}
 		if err != nil {
 			return nil, err
 		}
-		return os.ReadFile(wk.temp())
-	} else {
-		data, err := exportJPEG(ctx, wk.temp())
+		res = append(res, out)
+	}
+	return res, nil
+}
+
+// exportImage makes a JPEG or TIFF from the full size JPEG preview in data.
+func exportImage(wk *workspace, path string, data []byte, exp exportSettings) ([]byte, error) {
+	var err error
+	var wm *watermark
+	if exp.Watermark.enabled() {
+		wm, err = loadWatermark(exp.Watermark, func() (photoMeta, error) {
+			return loadPhotoMeta(path, wk.origXMP())
+		})
 		if err != nil {
 			return nil, err
 		}
-		if exp.Resample {
-			return resampleJPEG(data, exp)
+	}
+
+	dest := wk.jpeg()
+	upright := exp.Resample || exp.TIFF
+	policy := exp.metaPolicy()
+	switch {
+	case exp.TIFF:
+		dest = wk.tiff()
+		data, err = exportTIFF(data, exp, wm)
+	case exp.Resample:
+		data, err = resampleJPEG(data, exp, wm)
+	case wm != nil:
+		data, err = watermarkJPEG(data, wm)
+	}
+	if err != nil || upright && policy == metaNone {
+		return data, err
+	}
+
+	err = os.WriteFile(dest, data, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = fixMetaJPEG(wk.orig(), dest, policy, upright)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(dest)
+}
+
+func exportPath(path string, exp exportSettings) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + exp.Suffix + exportExt(exp)
+}
+
+func exportExt(exp exportSettings) string {
+	switch {
+	case exp.DNG:
+		return ".dng"
+	case exp.TIFF:
+		return ".tif"
+	default:
+		return ".jpg"
+	}
+}
+
+func exportType(exp exportSettings) string {
+	switch {
+	case exp.DNG:
+		return "image/x-adobe-dng"
+	case exp.TIFF:
+		return "image/tiff"
+	default:
+		return "image/jpeg"
+	}
+}
+
+// exportName names an export using the filename template.
+// The photo at path is named name (which can include a directory),
+// and seq is its sequence number in a batch.
+func exportName(path, name string, seq int, exp exportSettings) (string, error) {
+	if exp.Filename == "" {
+		return exportPath(name, exp), nil
+	}
+
+	var meta *photoMeta
+	var metaErr error
+	out, err := expandTemplate(exp.Filename, func(v, format string) (string, bool) {
+		switch v {
+		case "name":
+			return strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)), true
+		case "seq":
+			return formatSeq(seq, format)
 		}
+		if meta == nil {
+			var m photoMeta
+			m, metaErr = loadPhotoMeta(path, findSidecar(path)...)
+			meta = &m
+		}
+		return meta.lookup(v, format)
+	})
+	if metaErr != nil {
+		return "", metaErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid filename template: %w", err)
+	}
 
-		err = os.WriteFile(wk.jpeg(), data, 0600)
-		if err != nil {
-			return nil, err
+	out = sanitizeFilename(out)
+	if out == "" {
+		return "", fmt.Errorf("invalid filename template: %q makes an empty filename", exp.Filename)
+	}
+	return filepath.Join(filepath.Dir(name), out) + exp.Suffix + exportExt(exp), nil
+}
+
+// validFilename checks a filename template, without loading any metadata.
+func validFilename(tmpl string) error {
+	if tmpl == "" {
+		return nil
+	}
+	var meta photoMeta
+	out, err := expandTemplate(tmpl, func(v, format string) (string, bool) {
+		if v == "seq" {
+			return formatSeq(1, format)
 		}
-		err = fixMetaJPEG(wk.orig(), wk.jpeg())
-		if err != nil {
-			return nil, err
+		if _, ok := meta.lookup(v, format); ok {
+			return "x", true
 		}
-		return os.ReadFile(wk.jpeg())
+		return "", false
+	})
+	if err != nil {
+		return fmt.Errorf("invalid filename template: %w", err)
+	}
+	if sanitizeFilename(out) == "" {
+		return fmt.Errorf("invalid filename template: %q makes an empty filename", tmpl)
 	}
+	return nil
 }
 
-func exportPath(path string, exp exportSettings) string {
-	var ext string
-	if exp.DNG {
-		ext = ".dng"
-	} else {
-		ext = ".jpg"
+// formatSeq formats a sequence number, zero padded as in {seq:4}.
+func formatSeq(seq int, format string) (string, bool) {
+	if format == "" {
+		return strconv.Itoa(seq), true
 	}
-	return strings.TrimSuffix(path, filepath.Ext(path)) + ext
+	width, err := strconv.Atoi(format)
+	if err != nil || width < 1 || width > 9 {
+		return "", false
+	}
+	return fmt.Sprintf("%0*d", width, seq), true
+}
+
+// sanitizeFilename replaces characters that aren't valid in filenames,
+// and removes empty, . and .. path elements.
+// Forward slashes separate directories.
+func sanitizeFilename(name string) string {
+	var elems []string
+	for _, elem := range strings.Split(name, "/") {
+		elem = strings.Map(func(r rune) rune {
+			if r < ' ' || strings.ContainsRune(`\:*?"<>|`, r) {
+				return '_'
+			}
+			return r
+		}, elem)
+		elem = strings.TrimRight(strings.TrimSpace(elem), ".")
+		if elem != "" {
+			elems = append(elems, elem)
+		}
+	}
+	return filepath.Join(elems...)
 }
 
 func loadWhiteBalance(ctx context.Context, path string, coords []float64) (wb xmpWhiteBalance, err error) {
@@ -215,6 +397,13 @@ type exportSettings struct {
 	Lossy   bool
 	Embed   bool
 	Both    bool
+	TIFF    bool
+
+	Metadata string // see metaDefault, metaAll, etc
+	Filename string // a template, like "{date:2006-01-02}_{seq:4}"
+	Suffix   string // added to the filename, like "_web"
+
+	Renditions []exportSettings // JPEG/TIFF renditions to make from the same conversion
 
 	Resample bool
 	Quality  int
@@ -227,6 +416,78 @@ type exportSettings struct {
 	Density  int
 	DenUnit  string
 	MPixels  float64
+
+	Watermark watermarkSettings
+}
+
+func (ex *exportSettings) validate() error {
+	if !validMetaPolicy(ex.Metadata) {
+		return fmt.Errorf("invalid metadata policy: %q", ex.Metadata)
+	}
+	if err := validFilename(ex.Filename); err != nil {
+		return err
+	}
+	if ex.Suffix != sanitizeFilename(ex.Suffix) || strings.ContainsAny(ex.Suffix, `/\`) {
+		return fmt.Errorf("invalid filename suffix: %q", ex.Suffix)
+	}
+	if ex.Quality < 0 || ex.Quality > 12 {
+		return fmt.Errorf("invalid quality: %d", ex.Quality)
+	}
+	if ex.DNG && ex.TIFF {
+		return errors.New("invalid format: both DNG and TIFF")
+	}
+	if len(ex.Renditions) > 10 {
+		return errors.New("too many renditions")
+	}
+	for i := range ex.Renditions {
+		r := &ex.Renditions[i]
+		if r.DNG || r.Both || len(r.Renditions) > 0 {
+			return fmt.Errorf("invalid rendition %d: renditions can only be JPEG or TIFF", i+1)
+		}
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("invalid rendition %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// metaPolicy resolves the default metadata policy:
+// resampled exports are meant to be shared, so they don't leak location (or anything else).
+func (ex *exportSettings) metaPolicy() string {
+	if ex.Metadata != metaDefault {
+		return ex.Metadata
+	}
+	if ex.Resample {
+		return metaNone
+	}
+	return metaAll
+}
+
+// renditions lists everything that an export makes:
+// itself, a full size JPEG for Both, and any additional renditions.
+// Renditions inherit the metadata policy and filename template.
+func (ex *exportSettings) renditions() []exportSettings {
+	res := []exportSettings{*ex}
+	res[0].Both = false
+	res[0].Renditions = nil
+
+	if ex.Both && ex.DNG {
+		res = append(res, exportSettings{
+			Metadata:  ex.Metadata,
+			Filename:  ex.Filename,
+			Watermark: ex.Watermark,
+		})
+	}
+	for _, r := range ex.Renditions {
+		if r.Metadata == "" {
+			r.Metadata = ex.Metadata
+		}
+		if r.Filename == "" {
+			r.Filename = ex.Filename
+		}
+		res = append(res, r)
+	}
+	return res
 }
 
 func (ex *exportSettings) FitImage(size image.Point) (fit image.Point) {
@@ -323,7 +584,54 @@ func loadSidecar(src, dst string) error {
 	return err
 }
 
+// findSidecar returns the sidecar for src, if there's one.
+func findSidecar(src string) []string {
+	if name, err := xmpSidecar(src); err == nil && name != "" {
+		return []string{name}
+	}
+	return nil
+}
+
 func destSidecar(src string) (string, error) {
+	if name, err := xmpSidecar(src); err != nil || name != "" {
+		return name, err
+	}
+
+	ext := filepath.Ext(src)
+
+	// if NAME.DNG was edited, use it
+	if strings.EqualFold(ext, ".dng") && dngHasEdits(src) {
+		return src, nil
+	}
+
+	// fallback to NAME.xmp
+	return strings.TrimSuffix(src, ext) + ".xmp", nil
+}
+
+// readSidecar returns the XMP packet destSidecar would write to:
+// a sidecar, the XMP embedded in an edited DNG, or nothing.
+func readSidecar(src string) ([]byte, error) {
+	dest, err := destSidecar(src)
+	if err != nil {
+		return nil, err
+	}
+	if dest == src {
+		f, err := os.Open(src)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return xmp.ExtractXMP(f)
+	}
+	data, err := os.ReadFile(dest)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// xmpSidecar returns an existing XMP sidecar for src, or "" if there's none.
+func xmpSidecar(src string) (string, error) {
 	ext := filepath.Ext(src)
 
 	if ext != "" {
@@ -333,7 +641,7 @@ func destSidecar(src string) (string, error) {
 		if err == nil && xmp.IsSidecarForExt(bytes.NewReader(data), ext) {
 			return name, nil
 		}
-		if !errors.Is(err, fs.ErrNotExist) {
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
 			return "", err
 		}
 	}
@@ -344,12 +652,5 @@ func destSidecar(src string) (string, error) {
 	} else if !errors.Is(err, fs.ErrNotExist) {
 		return "", err
 	}
-
-	// if NAME.DNG was edited, use it
-	if strings.EqualFold(ext, ".dng") && dngHasEdits(src) {
-		return src, nil
-	}
-
-	// fallback to NAME.xmp
-	return strings.TrimSuffix(src, ext) + ".xmp", nil
+	return "", nil
 }
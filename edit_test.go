@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ncruces/go-exiftool"
+)
+
+func Test_sanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"", ""},
+		{"IMG_0001", "IMG_0001"},
+		{"2024/IMG_0001", filepath.Join("2024", "IMG_0001")},
+		{"../IMG_0001", "IMG_0001"},
+		{"/./IMG_0001", "IMG_0001"},
+		{`12:30 a\b`, "12_30 a_b"},
+		{"  name. ", "name"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeFilename(tt.name); got != tt.want {
+			t.Errorf("sanitizeFilename(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func Test_validFilename(t *testing.T) {
+	tests := []struct {
+		tmpl string
+		ok   bool
+	}{
+		{"", true},
+		{"{name}", true},
+		{"{date:2006-01-02}_{seq:4}", true},
+		{"{camera}/{lens}/{rating}", true},
+		{"{seq:x}", false},
+		{"{seq:0}", false},
+		{"{foo}", false},
+		{"{name", false},
+		{"..", false},
+	}
+	for _, tt := range tests {
+		if err := validFilename(tt.tmpl); (err == nil) != tt.ok {
+			t.Errorf("validFilename(%q) = %v", tt.tmpl, err)
+		}
+	}
+}
+
+func Test_exportName(t *testing.T) {
+	exp := exportSettings{Filename: "{seq:3}_{name}"}
+	got, err := exportName("/photos/IMG_0001.CR2", "trip/IMG_0001.CR2", 7, exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join("trip", "007_IMG_0001.jpg"); got != want {
+		t.Errorf("exportName() = %q, want %q", got, want)
+	}
+}
+
+func Test_exportSettings_renditions(t *testing.T) {
+	exp := exportSettings{
+		DNG: true, Both: true, Metadata: metaNoLocation,
+		Renditions: []exportSettings{
+			{Resample: true, Suffix: "_web"},
+			{TIFF: true, Metadata: metaNone},
+		},
+	}
+	if err := exp.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := exp.renditions()
+	if len(got) != 4 {
+		t.Fatalf("renditions() = %d, want 4", len(got))
+	}
+	if !got[0].DNG || got[0].Both || got[0].Renditions != nil {
+		t.Errorf("renditions()[0] = %+v", got[0])
+	}
+	if got[1].DNG || got[1].Metadata != metaNoLocation {
+		t.Errorf("renditions()[1] = %+v", got[1])
+	}
+	if got[2].Suffix != "_web" || got[2].Metadata != metaNoLocation {
+		t.Errorf("renditions()[2] = %+v", got[2])
+	}
+	if !got[3].TIFF || got[3].Metadata != metaNone {
+		t.Errorf("renditions()[3] = %+v", got[3])
+	}
+
+	exp.Renditions = append(exp.Renditions, exportSettings{DNG: true})
+	if err := exp.validate(); err == nil {
+		t.Error("validate() accepted a DNG rendition")
+	}
+}
+
+func Test_exportSettings_metaPolicy(t *testing.T) {
+	tests := []struct {
+		exp  exportSettings
+		want string
+	}{
+		{exportSettings{}, metaAll},
+		{exportSettings{DNG: true}, metaAll},
+		{exportSettings{TIFF: true}, metaAll},
+		{exportSettings{Resample: true}, metaNone},
+		{exportSettings{Resample: true, Metadata: metaAll}, metaAll},
+		{exportSettings{Resample: true, Metadata: metaCopyright}, metaCopyright},
+	}
+	for _, tt := range tests {
+		if got := tt.exp.metaPolicy(); got != tt.want {
+			t.Errorf("metaPolicy(%+v) = %q, want %q", tt.exp, got, tt.want)
+		}
+	}
+}
+
+func Test_exportImage_resampleNoGPS(t *testing.T) {
+	wk := workspace{base: t.TempDir() + string(filepath.Separator), ext: ".jpg"}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 64, 64)), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(wk.orig(), buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// without exiftool, the default policy must not need it
+	if exe, err := exec.LookPath("exiftool"); err == nil {
+		exiftool.Exec = exe
+		if _, err := setupExifTool(); err != nil {
+			t.Fatal(err)
+		}
+		defer exifserver.Shutdown()
+		_, err = exifserver.Command("-GPSLatitude=38.7", "-GPSLatitudeRef=N", "-overwrite_original", wk.orig())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(wk.orig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := exportSettings{Resample: true, Fit: "mpix", MPixels: 0.001}
+	out, err := exportImage(&wk, "photo.jpg", data, exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exifSegment(out) != nil || bytes.Contains(out, []byte("GPS")) {
+		t.Error("exportImage() kept metadata in a default resampled export")
+	}
+	if exifserver != nil {
+		if err := os.WriteFile(wk.jpeg(), out, 0600); err != nil {
+			t.Fatal(err)
+		}
+		tags, err := exifserver.Command("-short", "-GPS:all", "-XMP-exif:GPS*", wk.jpeg())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(tags), "GPS") {
+			t.Errorf("exportImage() = %q, want no GPS", tags)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Galleries can be sorted and filtered by photo metadata.
+//
+// Metadata is loaded from the catalog, if enabled, or from exiftool in batches,
+// and cached in memory, keyed by path and validated by the size and modification time of the photo.
+
+type galleryQuery struct {
+	Sort   string       // name, time, rating, camera
+	Desc   bool         // descending order
+	Rating int          // at least
+	Label  string       // color label
+	Camera string       // contains
+	Lens   string       // contains
+	ISO    galleryRange // inclusive
+	Focal  galleryRange // inclusive, in mm
+	Edited string       // true, false
+
+	Stack string  // burst, similar
+	Gap   float64 // seconds, for burst stacks
+
+	Recursive bool // include photos in subfolders
+	Page      int  // 1-based
+}
+
+type galleryRange struct {
+	Min, Max float64
+}
+
+func (r galleryRange) empty() bool {
+	return r.Min == 0 && r.Max == 0
+}
+
+func (r galleryRange) contains(v float64) bool {
+	return (r.Min == 0 || v >= r.Min) && (r.Max == 0 || v <= r.Max)
+}
+
+func (q *galleryQuery) validate() error {
+	switch q.Sort {
+	case "", "name", "time", "rating", "camera":
+	default:
+		return fmt.Errorf("invalid sort: %q", q.Sort)
+	}
+	if q.Rating < 0 || q.Rating > 5 {
+		return fmt.Errorf("invalid rating: %d", q.Rating)
+	}
+	if q.Label != "" {
+		label, ok := cullingLabel(q.Label)
+		if !ok {
+			return fmt.Errorf("invalid label: %q", q.Label)
+		}
+		q.Label = label
+	}
+	if q.Edited != "" {
+		if _, err := strconv.ParseBool(q.Edited); err != nil {
+			return fmt.Errorf("invalid edited: %q", q.Edited)
+		}
+	}
+	switch q.Stack {
+	case "":
+	case "burst", "similar":
+		if q.Sort == "" {
+			q.Sort = "time"
+		}
+	default:
+		return fmt.Errorf("invalid stack: %q", q.Stack)
+	}
+	if q.Gap < 0 || q.Gap > 60 {
+		return fmt.Errorf("invalid gap: %g", q.Gap)
+	}
+	if q.Page < 0 {
+		return fmt.Errorf("invalid page: %d", q.Page)
+	}
+	if q.ISO.Min < 0 || q.ISO.Max < 0 || q.Focal.Min < 0 || q.Focal.Max < 0 {
+		return errors.New("invalid range")
+	}
+	return nil
+}
+
+// filtered reports if the query removes any photos.
+func (q *galleryQuery) filtered() bool {
+	return q.Rating > 0 || q.Label != "" || q.Edited != "" ||
+		q.Camera != "" || q.Lens != "" || !q.ISO.empty() || !q.Focal.empty()
+}
+
+// needsSidecar reports if the query needs ratings and edits for every photo.
+func (q *galleryQuery) needsSidecar() bool {
+	return q.Sort == "rating" || q.Rating > 0 || q.Label != "" || q.Edited != "" || q.Stack != ""
+}
+
+// needsMeta reports if the query needs metadata from exiftool.
+func (q *galleryQuery) needsMeta() bool {
+	return q.Sort == "time" || q.Sort == "camera" || q.Stack == "burst" ||
+		q.Camera != "" || q.Lens != "" || !q.ISO.empty() || !q.Focal.empty()
+}
+
+func (q *galleryQuery) match(item *galleryItem) bool {
+	if item.Culling.Rating < q.Rating {
+		return false
+	}
+	if q.Label != "" && item.Culling.Label != q.Label {
+		return false
+	}
+	if edited, err := strconv.ParseBool(q.Edited); err == nil && item.Edited != edited {
+		return false
+	}
+	if !q.needsMeta() {
+		return true
+	}
+
+	meta := item.meta
+	if meta == nil {
+		meta = &galleryMeta{}
+	}
+	if q.Camera != "" && !containsFold(meta.Camera, q.Camera) {
+		return false
+	}
+	if q.Lens != "" && !containsFold(meta.Lens, q.Lens) {
+		return false
+	}
+	if !q.ISO.empty() && (meta.ISO == 0 || !q.ISO.contains(meta.ISO)) {
+		return false
+	}
+	if !q.Focal.empty() && (meta.Focal == 0 || !q.Focal.contains(meta.Focal)) {
+		return false
+	}
+	return true
+}
+
+// sort sorts items, breaking ties by name.
+func (q *galleryQuery) sort(items []galleryItem) {
+	var key func(a, b *galleryItem) int
+	switch q.Sort {
+	case "time":
+		key = func(a, b *galleryItem) int {
+			return a.meta.date().Compare(b.meta.date())
+		}
+	case "rating":
+		key = func(a, b *galleryItem) int {
+			return cmp.Compare(a.Culling.Rating, b.Culling.Rating)
+		}
+	case "camera":
+		key = func(a, b *galleryItem) int {
+			return cmp.Compare(a.meta.camera(), b.meta.camera())
+		}
+	}
+
+	slices.SortStableFunc(items, func(a, b galleryItem) int {
+		c := 0
+		if key != nil {
+			c = key(&a, &b)
+		}
+		if c == 0 {
+			c = cmp.Compare(a.Name, b.Name)
+		}
+		if q.Desc {
+			return -c
+		}
+		return c
+	})
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+type galleryMeta struct {
+	Date   time.Time
+	Camera string
+	Lens   string
+	ISO    float64
+	Focal  float64
+}
+
+func (m *galleryMeta) date() time.Time {
+	if m == nil {
+		return time.Time{}
+	}
+	return m.Date
+}
+
+func (m *galleryMeta) camera() string {
+	if m == nil {
+		return ""
+	}
+	return m.Camera
+}
+
+var galleryCache struct {
+	sync.Mutex
+	entries map[string]galleryCacheEntry
+}
+
+type galleryCacheEntry struct {
+	size    int64
+	modTime time.Time
+	xmpTime time.Time // of the sidecar
+	meta    galleryMeta
+}
+
+// galleryCacheLimit bounds the number of cached photos.
+const galleryCacheLimit = 100_000
+
+// loadGalleryMeta loads metadata for the photos at paths,
+// using the cache, and the catalog or a batched exiftool query for any misses.
+func loadGalleryMeta(paths []string) (map[string]*galleryMeta, error) {
+	res := make(map[string]*galleryMeta, len(paths))
+	stats := make(map[string]galleryCacheEntry, len(paths))
+	var missing []string
+
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		stat := galleryCacheEntry{size: fi.Size(), modTime: fi.ModTime()}
+		if sidecar, _ := xmpSidecar(path); sidecar != "" {
+			if si, err := os.Stat(sidecar); err == nil {
+				stat.xmpTime = si.ModTime()
+			}
+		}
+		stats[path] = stat
+	}
+
+	galleryCache.Lock()
+	for _, path := range paths {
+		stat, ok := stats[path]
+		if !ok {
+			continue
+		}
+		if e, ok := galleryCache.entries[path]; ok && e.size == stat.size && e.modTime.Equal(stat.modTime) && e.xmpTime.Equal(stat.xmpTime) {
+			meta := e.meta
+			res[path] = &meta
+		} else {
+			missing = append(missing, path)
+		}
+	}
+	galleryCache.Unlock()
+
+	const batch = 500
+	for chunk := range slices.Chunk(missing, batch) {
+		var metas map[string]*galleryMeta
+		if catalog != nil {
+			entries, err := catalog.load(chunk)
+			if err != nil {
+				return nil, err
+			}
+			metas = make(map[string]*galleryMeta, len(entries))
+			for path, e := range entries {
+				metas[path] = e.galleryMeta()
+			}
+		} else {
+			var err error
+			metas, err = queryGalleryMeta(chunk)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		galleryCache.Lock()
+		if galleryCache.entries == nil || len(galleryCache.entries) > galleryCacheLimit {
+			galleryCache.entries = make(map[string]galleryCacheEntry)
+		}
+		for _, path := range chunk {
+			// photos exiftool can't read are cached without metadata
+			meta := metas[path]
+			if meta == nil {
+				meta = &galleryMeta{}
+			}
+			e := stats[path]
+			e.meta = *meta
+			galleryCache.entries[path] = e
+			res[path] = meta
+		}
+		galleryCache.Unlock()
+	}
+	return res, nil
+}
+
+// queryGalleryMeta runs exiftool once for a batch of photos, and their sidecars.
+func queryGalleryMeta(paths []string) (map[string]*galleryMeta, error) {
+	opts := []string{"-json", "-fast2", "-d", "%Y-%m-%dT%H:%M:%S",
+		"-DateTimeOriginal", "-SubSecTimeOriginal", "-Make", "-Model", "-LensModel", "-Lens", "-ISO#", "-FocalLength#"}
+
+	log.Printf("exiftool (load gallery meta for %d photos)...", len(paths))
+	res, err := queryExifJSON(paths, opts, parseGalleryMeta)
+	if err != nil {
+		return nil, err
+	}
+
+	metas := make(map[string]*galleryMeta, len(res))
+	for path, pair := range res {
+		if meta := mergeGalleryMeta(pair); meta != nil {
+			metas[path] = meta
+		}
+	}
+	return metas, nil
+}
+
+// mergeGalleryMeta takes the metadata of a photo,
+// and a shifted capture time from its sidecar.
+func mergeGalleryMeta(pair [2]*galleryMeta) *galleryMeta {
+	meta, xmp := pair[0], pair[1]
+	if xmp != nil && !xmp.Date.IsZero() {
+		if meta == nil {
+			meta = &galleryMeta{}
+		}
+		meta.Date = xmp.Date
+	}
+	return meta
+}
+
+func parseGalleryMeta(out []byte) (map[string]*galleryMeta, error) {
+	files, err := parseExifJSON[struct {
+		DateTimeOriginal   jsonString
+		SubSecTimeOriginal jsonString
+		Make, Model        jsonString
+		LensModel, Lens    jsonString
+		ISO, FocalLength   jsonString
+	}](out)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*galleryMeta, len(files))
+	for path, f := range files {
+		meta := galleryMeta{
+			Camera: cameraName(string(f.Make), string(f.Model)),
+			Lens:   string(cmp.Or(f.LensModel, f.Lens)),
+		}
+		meta.ISO, _ = strconv.ParseFloat(string(f.ISO), 64)
+		meta.Focal, _ = strconv.ParseFloat(string(f.FocalLength), 64)
+		meta.Date, _ = time.ParseInLocation("2006-01-02T15:04:05", string(f.DateTimeOriginal), time.Local)
+		if sub, err := strconv.ParseFloat("0."+string(f.SubSecTimeOriginal), 64); err == nil && !meta.Date.IsZero() {
+			meta.Date = meta.Date.Add(time.Duration(sub * float64(time.Second)))
+		}
+		res[path] = &meta
+	}
+	return res, nil
+}
+
+// jsonString unmarshals exiftool values as strings,
+// even those that look like numbers.
+type jsonString string
+
+func (s *jsonString) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = jsonString(str)
+		return nil
+	}
+	var num json.Number
+	if err := json.Unmarshal(data, &num); err != nil {
+		return err
+	}
+	*s = jsonString(num)
+	return nil
+}
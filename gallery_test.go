@@ -0,0 +1,167 @@
+package main
+
+import (
+	"html/template"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func Test_galleryQuery_match(t *testing.T) {
+	item := galleryItem{
+		Name:    "a.CR3",
+		Edited:  true,
+		Culling: culling{Rating: 3, Label: "Red"},
+		meta:    &galleryMeta{Camera: "Canon EOS R5", Lens: "RF24-70mm F2.8 L IS USM", ISO: 400, Focal: 35},
+	}
+
+	tests := []struct {
+		query galleryQuery
+		want  bool
+	}{
+		{galleryQuery{}, true},
+		{galleryQuery{Rating: 3}, true},
+		{galleryQuery{Rating: 4}, false},
+		{galleryQuery{Label: "Red"}, true},
+		{galleryQuery{Label: "Blue"}, false},
+		{galleryQuery{Edited: "true"}, true},
+		{galleryQuery{Edited: "false"}, false},
+		{galleryQuery{Camera: "eos r5"}, true},
+		{galleryQuery{Camera: "Nikon"}, false},
+		{galleryQuery{Lens: "24-70"}, true},
+		{galleryQuery{ISO: galleryRange{Min: 100, Max: 400}}, true},
+		{galleryQuery{ISO: galleryRange{Min: 800}}, false},
+		{galleryQuery{Focal: galleryRange{Max: 24}}, false},
+		{galleryQuery{Focal: galleryRange{Min: 24, Max: 70}}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.query.match(&item); got != tt.want {
+			t.Errorf("%+v.match() = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// no metadata fails metadata filters
+	item.meta = nil
+	if q := (galleryQuery{ISO: galleryRange{Max: 400}}); q.match(&item) {
+		t.Errorf("%+v.match() = true, want false", q)
+	}
+}
+
+func Test_galleryQuery_sort(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	items := []galleryItem{
+		{Name: "c", Culling: culling{Rating: 1}, meta: &galleryMeta{Date: day.Add(time.Hour), Camera: "B"}},
+		{Name: "a", Culling: culling{Rating: 2}, meta: &galleryMeta{Date: day.Add(2 * time.Hour), Camera: "A"}},
+		{Name: "b", Culling: culling{Rating: 1}, meta: &galleryMeta{Date: day, Camera: "B"}},
+		{Name: "d"},
+	}
+
+	tests := []struct {
+		query galleryQuery
+		want  []string
+	}{
+		{galleryQuery{}, []string{"a", "b", "c", "d"}},
+		{galleryQuery{Desc: true}, []string{"d", "c", "b", "a"}},
+		{galleryQuery{Sort: "time"}, []string{"d", "b", "c", "a"}},
+		{galleryQuery{Sort: "rating", Desc: true}, []string{"a", "c", "b", "d"}},
+		{galleryQuery{Sort: "camera"}, []string{"d", "a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		items := slices.Clone(items)
+		tt.query.sort(items)
+		var got []string
+		for _, item := range items {
+			got = append(got, item.Name)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%+v.sort() = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func Test_parseGalleryMeta(t *testing.T) {
+	out := []byte(`[{
+  "SourceFile": "dir/a.NEF",
+  "DateTimeOriginal": "2024-05-06T07:08:09",
+  "SubSecTimeOriginal": 25,
+  "Make": "NIKON CORPORATION",
+  "Model": "NIKON Z 6",
+  "LensModel": 50,
+  "ISO": 200,
+  "FocalLength": 50
+},{
+  "SourceFile": "dir/b.NEF"
+}]`)
+
+	metas, err := parseGalleryMeta(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := metas[filepath.FromSlash("dir/a.NEF")]
+	if a == nil {
+		t.Fatalf("parseGalleryMeta() = %v, want dir/a.NEF", metas)
+	}
+	want := galleryMeta{
+		Date:   time.Date(2024, 5, 6, 7, 8, 9, 250_000_000, time.Local),
+		Camera: "NIKON Z 6",
+		Lens:   "50",
+		ISO:    200,
+		Focal:  50,
+	}
+	if !a.Date.Equal(want.Date) || a.Camera != want.Camera || a.Lens != want.Lens || a.ISO != want.ISO || a.Focal != want.Focal {
+		t.Errorf("parseGalleryMeta() = %+v, want %+v", *a, want)
+	}
+	if b := metas[filepath.FromSlash("dir/b.NEF")]; b == nil || b.Camera != "" || !b.Date.IsZero() {
+		t.Errorf("parseGalleryMeta() = %+v, want empty", b)
+	}
+}
+
+func Test_galleryQuery_validate(t *testing.T) {
+	valid := []galleryQuery{
+		{},
+		{Sort: "time", Desc: true, Rating: 5, Label: "green", Edited: "false"},
+	}
+	for _, q := range valid {
+		if err := q.validate(); err != nil {
+			t.Errorf("%+v.validate() = %v", q, err)
+		}
+	}
+	invalid := []galleryQuery{
+		{Sort: "size"},
+		{Rating: 6},
+		{Label: "Orange"},
+		{Edited: "maybe"},
+		{ISO: galleryRange{Min: -1}},
+		{Stack: "faces"},
+		{Stack: "burst", Gap: 120},
+	}
+	q := galleryQuery{Stack: "burst"}
+	if err := q.validate(); err != nil || q.Sort != "time" {
+		t.Errorf("%+v.validate() = %v, want time sort", q, err)
+	}
+	for _, q := range invalid {
+		if err := q.validate(); err == nil {
+			t.Errorf("%+v.validate() = nil, want error", q)
+		}
+	}
+}
+
+func Test_pageURL(t *testing.T) {
+	tests := []struct {
+		query string
+		page  int
+		want  template.URL
+	}{
+		{"", 2, "?page=2"},
+		{"page=3&recursive=true", 1, "?recursive=true"},
+		{"recursive=true&sort=time", 4, "?page=4&recursive=true&sort=time"},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		if got := pageURL(query, tt.page); got != tt.want {
+			t.Errorf("pageURL(%q, %d) = %q, want %q", tt.query, tt.page, got, tt.want)
+		}
+	}
+}
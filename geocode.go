@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ncruces/rethinkraw/internal/config"
+)
+
+// Photos are reverse geocoded offline, with a gazetteer from GeoNames (https://www.geonames.org/, CC BY 4.0),
+// which is bundled in GeoNamesDir as:
+//  . cities5000.txt, the cities with a population over 5000
+//  . admin1CodesASCII.txt, the names of states (first-level divisions)
+//  . countryInfo.txt, the names of countries
+//
+// The GPS position of a photo (from the sidecar, falling back to the photo) is matched to the nearest city,
+// which is written to the sidecar as photoshop:City, photoshop:State and photoshop:Country (see saveDescription).
+
+// maxPlaceDistance is how far (in km) a photo can be from the nearest city.
+const maxPlaceDistance = 50
+
+var (
+	errNoGPSPosition = errors.New("no GPS position")
+	errNoPlace       = errors.New("no city near the GPS position")
+)
+
+type place struct {
+	City, State, Country string
+	lat, lon             float64
+}
+
+type gazetteer struct {
+	places []place
+}
+
+var loadGazetteer = sync.OnceValues(func() (*gazetteer, error) {
+	open := func(name string) (*os.File, error) {
+		return os.Open(filepath.Join(config.GeoNamesDir, name))
+	}
+
+	f, err := open("countryInfo.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	countries, err := parseCountryInfo(f)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err = open("admin1CodesASCII.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	states, err := parseAdmin1Codes(f)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err = open("cities5000.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseCities(f, states, countries)
+})
+
+// parseCountryInfo parses countryInfo.txt, mapping ISO codes to names.
+func parseCountryInfo(r io.Reader) (map[string]string, error) {
+	res := map[string]string{}
+	err := scanGeoNames(r, func(fields []string) {
+		if len(fields) > 4 {
+			res[fields[0]] = fields[4]
+		}
+	})
+	return res, err
+}
+
+// parseAdmin1Codes parses admin1CodesASCII.txt, mapping codes, like "PT.14", to names.
+func parseAdmin1Codes(r io.Reader) (map[string]string, error) {
+	res := map[string]string{}
+	err := scanGeoNames(r, func(fields []string) {
+		if len(fields) > 1 {
+			res[fields[0]] = fields[1]
+		}
+	})
+	return res, err
+}
+
+// parseCities parses a cities file, like cities5000.txt.
+func parseCities(r io.Reader, states, countries map[string]string) (*gazetteer, error) {
+	var g gazetteer
+	err := scanGeoNames(r, func(fields []string) {
+		if len(fields) <= 10 {
+			return
+		}
+		lat, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return
+		}
+		lon, err := strconv.ParseFloat(fields[5], 64)
+		if err != nil {
+			return
+		}
+		cc := fields[8]
+		g.places = append(g.places, place{
+			City:    fields[1],
+			State:   states[cc+"."+fields[10]],
+			Country: countries[cc],
+			lat:     lat,
+			lon:     lon,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// scanGeoNames scans a tab separated GeoNames file, skipping comments.
+func scanGeoNames(r io.Reader, fn func(fields []string)) error {
+	scan := bufio.NewScanner(r)
+	scan.Buffer(nil, 1<<20)
+	for scan.Scan() {
+		line := scan.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fn(strings.Split(line, "\t"))
+	}
+	return scan.Err()
+}
+
+// nearest finds the nearest place to a position, and its distance in km.
+func (g *gazetteer) nearest(lat, lon float64) (res place, dist float64) {
+	dist = math.Inf(1)
+	for _, p := range g.places {
+		if d := haversine(lat, lon, p.lat, p.lon); d < dist {
+			res, dist = p, d
+		}
+	}
+	return res, dist
+}
+
+// haversine is the great-circle distance, in km, between two positions.
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371
+	rad := math.Pi / 180
+	dlat := (lat2 - lat1) * rad
+	dlon := (lon2 - lon1) * rad
+	a := math.Pow(math.Sin(dlat/2), 2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Pow(math.Sin(dlon/2), 2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// loadGPSPosition loads the GPS position of a photo.
+func loadGPSPosition(path string) (lat, lon float64, err error) {
+	log.Print("exiftool (load GPS position)...")
+	res, err := queryExifJSON([]string{path}, []string{"-json", "-n", "-fast2", "-GPSPosition"}, parseGPSPositions)
+	if err != nil {
+		return 0, 0, err
+	}
+	// the sidecar prevails
+	pair := res[path]
+	for _, p := range []*[2]float64{pair[1], pair[0]} {
+		if p != nil {
+			return p[0], p[1], nil
+		}
+	}
+	return 0, 0, errNoGPSPosition
+}
+
+func parseGPSPositions(out []byte) (map[string]*[2]float64, error) {
+	files, err := parseExifJSON[struct{ GPSPosition jsonString }](out)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*[2]float64, len(files))
+	for path, f := range files {
+		lat, lon, ok := strings.Cut(strings.TrimSpace(string(f.GPSPosition)), " ")
+		if !ok {
+			continue
+		}
+		var p [2]float64
+		var err1, err2 error
+		p[0], err1 = strconv.ParseFloat(lat, 64)
+		p[1], err2 = strconv.ParseFloat(strings.TrimSpace(lon), 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		res[path] = &p
+	}
+	return res, nil
+}
+
+// reverseGeocode fills in the city, state and country of a photo, from its GPS position.
+// Unless overwrite, only empty fields are filled.
+func reverseGeocode(path string, overwrite bool) error {
+	g, err := loadGazetteer()
+	if err != nil {
+		return err
+	}
+	lat, lon, err := loadGPSPosition(path)
+	if err != nil {
+		return err
+	}
+	p, dist := g.nearest(lat, lon)
+	if dist > maxPlaceDistance {
+		return errNoPlace
+	}
+
+	d := description{City: p.City, State: p.State, Country: p.Country}
+	update := []string{"city", "state", "country"}
+	if !overwrite {
+		cur, err := loadDescription(path)
+		if err != nil {
+			return err
+		}
+		update = geocodeUpdate(cur)
+	}
+	return saveDescription(path, d, update...)
+}
+
+// geocodeUpdate is the location fields that are empty in d.
+func geocodeUpdate(d description) []string {
+	var update []string
+	if d.City == "" {
+		update = append(update, "city")
+	}
+	if d.State == "" {
+		update = append(update, "state")
+	}
+	if d.Country == "" {
+		update = append(update, "country")
+	}
+	return update
+}
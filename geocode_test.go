@@ -0,0 +1,99 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func Test_parseCities(t *testing.T) {
+	countries, err := parseCountryInfo(strings.NewReader("" +
+		"#ISO\tISO3\tISO-Numeric\tfips\tCountry\tCapital\n" +
+		"PT\tPRT\t620\tPO\tPortugal\tLisbon\n" +
+		"ES\tESP\t724\tSP\tSpain\tMadrid\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	states, err := parseAdmin1Codes(strings.NewReader("" +
+		"PT.14\tLisbon\tLisbon\t2267056\n" +
+		"PT.17\tPorto\tPorto\t2735941\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := parseCities(strings.NewReader(""+
+		"2267057\tLisbon\tLisbon\tLisboa\t38.71667\t-9.13333\tP\tPPLC\tPT\t\t14\t1106\t\t\t517802\t\t45\tEurope/Lisbon\t2022-03-22\n"+
+		"2735943\tPorto\tPorto\tOporto\t41.14961\t-8.61099\tP\tPPLA\tPT\t\t17\t1312\t\t\t249633\t\t93\tEurope/Lisbon\t2022-03-22\n"+
+		"2521978\tBadajoz\tBadajoz\t\t38.87789\t-6.97061\tP\tPPLA2\tES\t\t57\tBA\t06015\t\t148334\t\t186\tEurope/Madrid\t2012-03-04\n"+
+		"broken line\n"), states, countries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.places) != 3 {
+		t.Fatalf("parseCities() = %d places, want 3", len(g.places))
+	}
+
+	tests := []struct {
+		lat, lon float64
+		want     place
+	}{
+		{38.7, -9.1, place{City: "Lisbon", State: "Lisbon", Country: "Portugal"}},
+		{41.0, -8.6, place{City: "Porto", State: "Porto", Country: "Portugal"}},
+		{38.9, -7.0, place{City: "Badajoz", Country: "Spain"}}, // state unknown
+	}
+	for _, tt := range tests {
+		got, dist := g.nearest(tt.lat, tt.lon)
+		got.lat, got.lon = 0, 0
+		if !reflect.DeepEqual(got, tt.want) || dist > maxPlaceDistance {
+			t.Errorf("nearest(%v, %v) = %v, %v, want %v", tt.lat, tt.lon, got, dist, tt.want)
+		}
+	}
+}
+
+func Test_haversine(t *testing.T) {
+	// Lisbon to Porto, about 274 km
+	if d := haversine(38.71667, -9.13333, 41.14961, -8.61099); math.Abs(d-274) > 1 {
+		t.Errorf("haversine() = %v, want 274", d)
+	}
+	if d := haversine(10, 179.9, 10, -179.9); d > 25 {
+		t.Errorf("haversine() = %v, across the antimeridian", d)
+	}
+}
+
+func Test_parseGPSPositions(t *testing.T) {
+	out := []byte(`[{
+		"SourceFile": "dir/IMG_0001.CR3",
+		"GPSPosition": "38.71667 -9.13333"
+	}, {
+		"SourceFile": "dir/IMG_0002.CR3"
+	}]`)
+
+	got, err := parseGPSPositions(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]*[2]float64{
+		filepath.FromSlash("dir/IMG_0001.CR3"): {38.71667, -9.13333},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseGPSPositions() = %v, want %v", got, want)
+	}
+}
+
+func Test_geocodeUpdate(t *testing.T) {
+	tests := []struct {
+		d    description
+		want []string
+	}{
+		{description{}, []string{"city", "state", "country"}},
+		{description{Country: "Portugal"}, []string{"city", "state"}},
+		{description{City: "Lisbon", State: "Lisbon", Country: "Portugal"}, nil},
+	}
+	for _, tt := range tests {
+		if got := geocodeUpdate(tt.d); !slices.Equal(got, tt.want) {
+			t.Errorf("geocodeUpdate(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ncruces/rethinkraw/internal/config"
+)
+
+// Photos are geotagged from a GPS track (GPX, KML, NMEA, and others exiftool reads) with exiftool -geotag:
+// the capture time of each photo (see photoTimes) is matched to the track, and GPS tags are written to the sidecar.
+//
+// Capture times that don't have a time zone are taken in the given one (or the local one),
+// and corrected for a camera clock that was off.
+
+type geotagSettings struct {
+	TrackPath string // the track file, as a user path (unless uploaded)
+	Timezone  string // as "+01:00", or "Europe/Lisbon"
+	Offset    string // camera clock correction (see parseTimeOffset)
+	Geocode   bool   // fill in the location (see reverseGeocode)
+	Overwrite bool   // of the location
+}
+
+var errNoGPSFix = errors.New("no GPS fix near the capture time")
+
+// location is the time zone for capture times that don't have one.
+func (s *geotagSettings) location() (*time.Location, error) {
+	tz := strings.TrimSpace(s.Timezone)
+	switch tz {
+	case "":
+		return time.Local, nil
+	case "Z", "UTC":
+		return time.UTC, nil
+	}
+	if t, err := time.Parse("-07:00", tz); err == nil {
+		_, offset := t.Zone()
+		return time.FixedZone(tz, offset), nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone: %q", s.Timezone)
+	}
+	return loc, nil
+}
+
+// offset is the camera clock correction.
+func (s *geotagSettings) offset() (time.Duration, error) {
+	if strings.TrimSpace(s.Offset) == "" {
+		return 0, nil
+	}
+	return parseTimeOffset(s.Offset)
+}
+
+// geotime is the time to match to the track for a photo.
+func geotime(t *photoTimes, offset time.Duration, loc *time.Location) (time.Time, error) {
+	orig := t.original()
+	if orig.IsZero() {
+		return time.Time{}, errNoCaptureTime
+	}
+	return orig.add(offset).instant(loc), nil
+}
+
+// geotag writes GPS tags to the sidecar of a photo, taken at a given time.
+func geotag(path, track string, when time.Time) error {
+	log.Print("exiftool (geotag)...")
+	err := writeSidecar(path, []string{"-geotag", track, "-geotime=" + when.Format("2006:01:02 15:04:05.999-07:00")})
+	if err != nil {
+		return err
+	}
+
+	// exiftool writes nothing, quietly, if there's no fix;
+	// the time of the fix tells if it was written now
+	dest, err := destSidecar(path)
+	if err != nil {
+		return err
+	}
+	out, err := exifserver.Command("-n", "-short3", "-fast2", "-GPSDateTime", dest)
+	if err != nil {
+		return err
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	fix, ok := parseExifTime(line)
+	if !ok || fix.instant(time.UTC).Sub(when).Abs() >= time.Second {
+		return errNoGPSFix
+	}
+	return nil
+}
+
+// saveTrack saves an uploaded track to a temporary file.
+func saveTrack(name string, r io.Reader) (string, error) {
+	if err := os.MkdirAll(config.TempDir, 0700); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(config.TempDir, "track-*"+filepath.Ext(name))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ncruces/go-exiftool"
+)
+
+func Test_geotagSettings_location(t *testing.T) {
+	tests := []struct {
+		tz     string
+		offset int
+		ok     bool
+	}{
+		{"", 0, true},
+		{"Z", 0, true},
+		{"+01:00", 3600, true},
+		{"-05:30", -19800, true},
+		{"Mars/Olympus_Mons", 0, false},
+	}
+	for _, tt := range tests {
+		s := geotagSettings{Timezone: tt.tz}
+		loc, err := s.location()
+		if (err == nil) != tt.ok {
+			t.Errorf("location(%q) = %v, want %v", tt.tz, err, tt.ok)
+			continue
+		}
+		if err != nil || tt.tz == "" {
+			continue
+		}
+		if _, offset := time.Date(2024, 1, 1, 0, 0, 0, 0, loc).Zone(); offset != tt.offset {
+			t.Errorf("location(%q) = %d, want %d", tt.tz, offset, tt.offset)
+		}
+	}
+}
+
+func Test_exifTime_instant(t *testing.T) {
+	plus1 := time.FixedZone("", 3600)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2024:05:06 07:08:09", time.Date(2024, 5, 6, 6, 8, 9, 0, time.UTC)},
+		{"2024:05:06 07:08:09.5", time.Date(2024, 5, 6, 6, 8, 9, 500_000_000, time.UTC)},
+		{"2024:05:06 07:08:09Z", time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)},
+		{"2024:05:06 07:08:09-02:00", time.Date(2024, 5, 6, 9, 8, 9, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		e, _ := parseExifTime(tt.in)
+		if got := e.instant(plus1); !got.Equal(tt.want) {
+			t.Errorf("instant(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func Test_geotime(t *testing.T) {
+	orig, _ := parseExifTime("2024:05:06 07:08:09")
+	times := &photoTimes{Photo: captureTime{Original: orig}}
+
+	got, err := geotime(times, -time.Hour, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 5, 6, 6, 8, 9, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("geotime() = %v, want %v", got, want)
+	}
+
+	if _, err := geotime(&photoTimes{}, 0, time.UTC); !errors.Is(err, errNoCaptureTime) {
+		t.Errorf("geotime() = %v, want %v", err, errNoCaptureTime)
+	}
+}
+
+func Test_geotag_keepMetadata(t *testing.T) {
+	exe, err := exec.LookPath("exiftool")
+	if err != nil {
+		t.Skip("exiftool not found")
+	}
+	exiftool.Exec = exe
+	if _, err := setupExifTool(); err != nil {
+		t.Fatal(err)
+	}
+	defer exifserver.Shutdown()
+
+	dir := t.TempDir()
+	photo := filepath.Join(dir, "IMG_0001.CR2")
+	track := filepath.Join(dir, "track.gpx")
+	if err := os.WriteFile(photo, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(track, []byte(`<?xml version="1.0"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1"><trk><trkseg>
+<trkpt lat="38.7" lon="-9.1"><time>2024-05-06T07:08:00Z</time></trkpt>
+<trkpt lat="38.8" lon="-9.2"><time>2024-05-06T07:09:00Z</time></trkpt>
+</trkseg></trk></gpx>`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := geotag(photo, track, time.Date(2024, 5, 6, 7, 8, 30, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	sidecar, err := destSidecar(photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// saving edits rewrites the sidecar, keeping metadata (see saveEdit)
+	edited := filepath.Join(dir, "edited.xmp")
+	if _, err := exifserver.Command("-XMP-crs:Exposure2012=+1.0", edited); err != nil {
+		t.Fatal(err)
+	}
+	if err := keepMetadata(sidecar, edited); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exifserver.Command("-short", "-XMP-exif:GPSLatitude", "-XMP-exif:GPSLongitude", edited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "GPSLatitude") || !strings.Contains(string(out), "GPSLongitude") {
+		t.Errorf("keepMetadata() lost GPS: %q", out)
+	}
+}
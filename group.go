@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ncruces/rethinkraw/pkg/osutil"
+)
+
+// A RAW photo is grouped with its siblings in the same folder:
+//  . JPEGs shot alongside it (RAW+JPEG), as NAME.JPG or NAME.JPEG
+//  . XMP sidecars, as NAME.xmp or NAME.EXT.xmp
+//
+// Siblings named after more than one RAW (like NAME.JPG for NAME.CR2 and NAME.DNG)
+// are left ungrouped, so acting on a group never affects another photo.
+
+var siblingExtensions = map[string]struct{}{
+	".JPG": {}, ".JPEG": {}, ".XMP": {},
+}
+
+// photoGroups maps the RAW photos in a folder to their siblings, given all file names in the folder.
+func photoGroups(names []string) map[string][]string {
+	stem := func(name string) string {
+		return strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+	}
+
+	raws := map[string][]string{}
+	for _, name := range names {
+		if _, ok := extensions[strings.ToUpper(filepath.Ext(name))]; ok {
+			raws[stem(name)] = append(raws[stem(name)], name)
+		}
+	}
+
+	groups := map[string][]string{}
+	for _, name := range names {
+		ext := strings.ToUpper(filepath.Ext(name))
+		if _, ok := siblingExtensions[ext]; !ok {
+			continue
+		}
+		owners := raws[stem(name)]
+		if ext == ".XMP" {
+			// NAME.EXT.xmp
+			for _, raw := range raws[stem(stem(name))] {
+				if strings.EqualFold(raw, strings.TrimSuffix(name, filepath.Ext(name))) {
+					owners = append(owners, raw)
+				}
+			}
+		}
+		if len(owners) == 1 {
+			groups[owners[0]] = append(groups[owners[0]], name)
+		}
+	}
+	return groups
+}
+
+// findSiblings finds the siblings of photos, reading each of their folders once.
+func findSiblings(paths []string) (map[string][]string, error) {
+	dirs := map[string][]string{}
+	for _, path := range paths {
+		dir, name := filepath.Split(path)
+		dirs[dir] = append(dirs[dir], name)
+	}
+
+	res := map[string][]string{}
+	for dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, entry := range entries {
+			if entry.Type().IsRegular() && !osutil.HiddenFile(entry) {
+				names = append(names, entry.Name())
+			}
+		}
+		for raw, siblings := range photoGroups(names) {
+			for _, name := range siblings {
+				path := filepath.Join(dir, raw)
+				res[path] = append(res[path], filepath.Join(dir, name))
+			}
+		}
+	}
+	return res, nil
+}
+
+// moveGroup moves files to dir, never overwriting existing files.
+// If a file fails to move, those already moved are moved back.
+func moveGroup(files []string, dir string) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	for _, file := range files {
+		dst := filepath.Join(dir, filepath.Base(file))
+		if _, err := os.Lstat(dst); err == nil {
+			return fmt.Errorf("file already exists: %s", dst)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	for i, file := range files {
+		if err := osutil.Move(file, filepath.Join(dir, filepath.Base(file))); err != nil {
+			for _, file := range slices.Backward(files[:i]) {
+				if rerr := osutil.Move(filepath.Join(dir, filepath.Base(file)), file); rerr != nil {
+					err = errors.Join(err, rerr)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteGroup deletes files.
+func deleteGroup(files []string) error {
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func Test_photoGroups(t *testing.T) {
+	names := []string{
+		"a.CR2", "a.JPG", "a.xmp",
+		"b.NEF", "b.NEF.xmp", "b.jpeg",
+		"c.CR2", "c.DNG", "c.JPG", "c.CR2.xmp",
+		"d.JPG", "e.ARW",
+		"notes.txt",
+	}
+	want := map[string][]string{
+		"a.CR2": {"a.JPG", "a.xmp"},
+		"b.NEF": {"b.NEF.xmp", "b.jpeg"},
+		"c.CR2": {"c.CR2.xmp"},
+	}
+
+	got := photoGroups(names)
+	for _, siblings := range got {
+		slices.Sort(siblings)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("photoGroups() = %v, want %v", got, want)
+	}
+}
+
+func Test_moveGroup(t *testing.T) {
+	src := t.TempDir()
+	dst := filepath.Join(t.TempDir(), "sub")
+	var files []string
+	for _, name := range []string{"a.CR2", "a.JPG", "a.xmp"} {
+		file := filepath.Join(src, name)
+		if err := os.WriteFile(file, []byte(name), 0666); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+
+	if err := moveGroup(files, dst); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("moveGroup() left %s", file)
+		}
+		if _, err := os.Stat(filepath.Join(dst, filepath.Base(file))); err != nil {
+			t.Errorf("moveGroup() = %v", err)
+		}
+	}
+
+	// never overwrite
+	os.WriteFile(files[0], nil, 0666)
+	if err := moveGroup(files[:1], dst); err == nil {
+		t.Error("moveGroup() overwrote a file")
+	}
+
+	// roll back a partial move
+	other := filepath.Join(t.TempDir(), "other")
+	missing := filepath.Join(src, "b.CR2")
+	if err := moveGroup([]string{files[0], missing}, other); err == nil {
+		t.Error("moveGroup() moved a missing file")
+	}
+	if _, err := os.Stat(files[0]); err != nil {
+		t.Errorf("moveGroup() didn't roll back: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(other, filepath.Base(files[0]))); !os.IsNotExist(err) {
+		t.Error("moveGroup() left a partial move")
+	}
+
+	if err := deleteGroup(files); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(files[0]); !os.IsNotExist(err) {
+		t.Errorf("deleteGroup() left %s", files[0])
+	}
+}
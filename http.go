@@ -27,9 +27,14 @@ func setupHTTP() *http.Server {
 	mux.Handle("/gallery/", http.StripPrefix("/gallery", httpHandler(galleryHandler)))
 	mux.Handle("/photo/", http.StripPrefix("/photo", httpHandler(photoHandler)))
 	mux.Handle("/batch/", http.StripPrefix("/batch", httpHandler(batchHandler)))
+	mux.Handle("/search/", http.StripPrefix("/search", httpHandler(searchHandler)))
 	mux.Handle("/thumb/", http.StripPrefix("/thumb", httpHandler(thumbHandler)))
 	mux.Handle("/dialog", httpHandler(dialogHandler))
 	mux.Handle("/upload", httpHandler(uploadHandler))
+	mux.Handle("/watermark", httpHandler(watermarkHandler))
+	mux.Handle("/preset", httpHandler(presetHandler))
+	mux.Handle("/template", httpHandler(templateHandler))
+	mux.Handle("/keywords", httpHandler(keywordsHandler))
 	mux.Handle("/", assetHandler)
 
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -106,6 +111,9 @@ func errorStatus(err error) (status int, message string) {
 		status = http.StatusNotFound
 	case errors.Is(err, fs.ErrPermission):
 		status = http.StatusForbidden
+	case errors.Is(err, errNoCaptureTime), errors.Is(err, errNoGPSFix),
+		errors.Is(err, errNoGPSPosition), errors.Is(err, errNoPlace):
+		status = http.StatusUnprocessableEntity
 	default:
 		status = http.StatusInternalServerError
 	}
@@ -144,15 +152,24 @@ func sendError(w http.ResponseWriter, r *http.Request, status int, message strin
 	}
 }
 
-func sendCached(w http.ResponseWriter, r *http.Request, path string) httpResult {
+// sendCached handles conditional requests for path,
+// which is modified if any of its dependencies are.
+func sendCached(w http.ResponseWriter, r *http.Request, path string, deps ...string) httpResult {
 	if fi, err := os.Stat(path); err != nil {
 		return httpResult{Error: err}
 	} else {
+		modTime := fi.ModTime()
+		for _, dep := range deps {
+			if fi, err := os.Stat(dep); err == nil && fi.ModTime().After(modTime) {
+				modTime = fi.ModTime()
+			}
+		}
+
 		headers := w.Header()
-		headers.Set("Last-Modified", fi.ModTime().UTC().Format(http.TimeFormat))
+		headers.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
 		if ims := r.Header.Get("If-Modified-Since"); ims != "" {
 			if t, err := http.ParseTime(ims); err == nil {
-				if fi.ModTime().Before(t.Add(time.Second)) {
+				if modTime.Before(t.Add(time.Second)) {
 					for k := range headers {
 						switch k {
 						case "Cache-Control", "Last-Modified":
@@ -222,6 +239,15 @@ func fromURLPath(path, prefix string) string {
 	return filepath.Join(prefix, path)
 }
 
+// fromUsrPath is the inverse of toUsrPath.
+// Paths can't escape the prefix.
+func fromUsrPath(path, prefix string) string {
+	if prefix == "" {
+		return filepath.Clean(path)
+	}
+	return fromURLPath(filepath.ToSlash(filepath.Clean("/"+path)), prefix)
+}
+
 func matchHostServerName(r *http.Request) bool {
 	if r.TLS == nil {
 		return true
@@ -1,14 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 
 	"github.com/gorilla/schema"
+	"github.com/ncruces/rethinkraw/internal/util"
 	"github.com/ncruces/rethinkraw/pkg/osutil"
 	"github.com/ncruces/zenity"
 )
@@ -16,6 +21,7 @@ import (
 type multiStatus struct {
 	Code  int    `json:"code"`
 	Text  string `json:"text"`
+	Photo string `json:"photo,omitempty"`
 	Body  any    `json:"response,omitempty"`
 	Done  int    `json:"done,omitempty"`
 	Total int    `json:"total,omitempty"`
@@ -39,11 +45,36 @@ func batchHandler(w http.ResponseWriter, r *http.Request) httpResult {
 		return httpResult{Error: err}
 	}
 
+	_, meta := r.Form["meta"]
 	_, save := r.Form["save"]
 	_, export := r.Form["export"]
 	_, settings := r.Form["settings"]
+	_, contact := r.Form["contact"]
+	_, move := r.Form["move"]
+	_, del := r.Form["delete"]
+	_, describe := r.Form["describe"]
+	_, template := r.Form["template"]
+	_, timeshift := r.Form["timeshift"]
+	_, geotags := r.Form["geotag"]
+	_, geocode := r.Form["geocode"]
+	_, compare := r.Form["compare"]
 
 	switch {
+	case meta:
+		if r.Form.Get("meta") != "json" {
+			return httpResult{Status: http.StatusUnprocessableEntity, Message: "metadata is only available as JSON"}
+		}
+		if len(photos) == 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte("[]\n"))
+			return httpResult{}
+		}
+		paths := make([]string, len(photos))
+		for i, photo := range photos {
+			paths[i] = photo.Path
+		}
+		return sendMetaJSON(w, paths, r.Form["tags"], prefix, false)
+
 	case save:
 		var xmp xmpSettings
 		dec := schema.NewDecoder()
@@ -72,13 +103,26 @@ func batchHandler(w http.ResponseWriter, r *http.Request) httpResult {
 		if err := dec.Decode(&xmp, r.Form); err != nil {
 			return httpResult{Error: err}
 		}
-		if err := dec.Decode(&exp, r.Form); err != nil {
-			return httpResult{Error: err}
+		if r := decodeExport(&exp, r.Form); r.Done() {
+			return r
 		}
 		xmp.Orientation = 0
 
+		seq := make(map[string]int, len(photos))
+		for i, photo := range photos {
+			seq[photo.Path] = i + 1
+		}
+
 		var exppath string
-		if len(photos) > 0 {
+		if dest := r.Form.Get("dest"); dest != "" {
+			dir, res := exportDest(dest, prefix)
+			if res.Done() {
+				return res
+			}
+			exppath = dir
+		} else if !isLocalhost(r) {
+			return batchExportZIP(w, r, photos, seq, xmp, exp)
+		} else if len(photos) > 0 {
 			exppath = filepath.Dir(photos[0].Path)
 			if res, err := zenity.SelectFile(zenity.Context(r.Context()), zenity.Directory(), zenity.Filename(exppath)); res != "" {
 				exppath = res
@@ -92,18 +136,462 @@ func batchHandler(w http.ResponseWriter, r *http.Request) httpResult {
 		}
 
 		results := batchProcess(r.Context(), photos, func(ctx context.Context, photo batchPhoto) error {
-			err := batchProcessPhoto(ctx, photo, exppath, xmp, exp)
-			if err == nil && exp.Both {
-				err = batchProcessPhoto(ctx, photo, exppath, xmp, exportSettings{})
+			return batchProcessPhoto(ctx, photo, seq[photo.Path], exppath, xmp, exp)
+		})
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusMultiStatus)
+		batchResultWriter(w, results, len(photos))
+		return httpResult{}
+
+	case contact:
+		var cs contactSettings
+		dec := schema.NewDecoder()
+		dec.IgnoreUnknownKeys(true)
+		if err := dec.Decode(&cs, r.Form); err != nil {
+			return httpResult{Error: err}
+		}
+		if err := cs.validate(); err != nil {
+			return httpResult{Status: http.StatusUnprocessableEntity, Message: err.Error()}
+		}
+		if len(photos) == 0 {
+			return httpResult{Status: http.StatusNoContent}
+		}
+
+		dir := filepath.Dir(photos[0].Path)
+		exppath := filepath.Join(dir, filepath.Base(dir)+".pdf")
+		dest := r.Form.Get("dest")
+		if dest != "" {
+			dir, res := exportDest(dest, prefix)
+			if res.Done() {
+				return res
+			}
+			exppath = filepath.Join(dir, filepath.Base(exppath))
+		} else if isLocalhost(r) {
+			if res, err := zenity.SelectFileSave(zenity.Context(r.Context()), zenity.Filename(exppath), zenity.ConfirmOverwrite()); res != "" {
+				exppath = res
+			} else if errors.Is(err, zenity.ErrCanceled) {
+				return httpResult{Status: http.StatusNoContent}
+			} else if err == nil {
+				return httpResult{Status: http.StatusInternalServerError}
+			} else {
+				return httpResult{Error: err}
 			}
+		}
+
+		index := make(map[string]int, len(photos))
+		for i, photo := range photos {
+			index[photo.Path] = i
+		}
+		sheet := make([]contactPhoto, len(photos))
+		results := batchProcess(r.Context(), photos, func(ctx context.Context, photo batchPhoto) error {
+			res, err := loadContactPhoto(ctx, photo.Path, cs)
+			if err != nil {
+				res = failedContactPhoto(photo.Name, err)
+			}
+			sheet[index[photo.Path]] = res
 			return err
 		})
+		for range results {
+		}
+		if err := r.Context().Err(); err != nil {
+			return httpResult{Error: err}
+		}
+
+		var buf bytes.Buffer
+		if err := writeContactSheet(&buf, cs, sheet); err != nil {
+			return httpResult{Error: err}
+		}
+
+		if dest != "" {
+			if err := writeNewFile(exppath, buf.Bytes()); err != nil {
+				return httpResult{Error: err}
+			}
+			return httpResult{Status: http.StatusNoContent}
+		} else if isLocalhost(r) {
+			if err := os.WriteFile(exppath, buf.Bytes(), 0666); err != nil {
+				return httpResult{Error: err}
+			}
+			return httpResult{Status: http.StatusNoContent}
+		} else {
+			name := filepath.Base(exppath)
+			w.Header().Set("Content-Disposition", "attachment; filename*=UTF-8''"+util.PercentEncode(name))
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write(buf.Bytes())
+			return httpResult{}
+		}
+
+	case move, del:
+		if r := sendAllowed(w, r, "POST"); r.Done() {
+			return r
+		}
+		var opts struct {
+			Group bool
+			Dest  string
+		}
+		dec := schema.NewDecoder()
+		dec.IgnoreUnknownKeys(true)
+		if err := dec.Decode(&opts, r.Form); err != nil {
+			return httpResult{Error: err}
+		}
+		if len(photos) == 0 {
+			return httpResult{Status: http.StatusNoContent}
+		}
+
+		var dir string
+		if move {
+			if opts.Dest != "" {
+				d, res := exportDest(opts.Dest, prefix)
+				if res.Done() {
+					return res
+				}
+				dir = d
+			} else if isLocalhost(r) {
+				if res, err := zenity.SelectFile(zenity.Context(r.Context()), zenity.Directory(), zenity.Filename(filepath.Dir(photos[0].Path))); res != "" {
+					dir = res
+				} else if errors.Is(err, zenity.ErrCanceled) {
+					return httpResult{Status: http.StatusNoContent}
+				} else if err == nil {
+					return httpResult{Status: http.StatusInternalServerError}
+				} else {
+					return httpResult{Error: err}
+				}
+			} else {
+				return httpResult{Status: http.StatusUnprocessableEntity, Message: "missing destination"}
+			}
+		}
+
+		var siblings map[string][]string
+		if opts.Group {
+			var paths []string
+			for _, photo := range photos {
+				paths = append(paths, photo.Path)
+			}
+			siblings, err = findSiblings(paths)
+			if err != nil {
+				return httpResult{Error: err}
+			}
+		}
+
+		results := batchProcess(r.Context(), photos, func(ctx context.Context, photo batchPhoto) error {
+			files := append([]string{photo.Path}, siblings[photo.Path]...)
+			defer catalogUpdate(photo.Path, false)
+			if move {
+				// keep the structure of subfolders
+				dir := filepath.Join(dir, filepath.Dir(photo.Name))
+				defer catalogUpdate(filepath.Join(dir, filepath.Base(photo.Path)), false)
+				return moveGroup(files, dir)
+			}
+			return deleteGroup(files)
+		})
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusMultiStatus)
+		batchResultWriter(w, results, len(photos))
+		return httpResult{}
+
+	case describe:
+		if r := sendAllowed(w, r, "POST"); r.Done() {
+			return r
+		}
+		var d description
+		var edit struct{ AddKeywords, RemoveKeywords []string }
+		dec := schema.NewDecoder()
+		dec.IgnoreUnknownKeys(true)
+		if err := dec.Decode(&d, r.Form); err != nil {
+			return httpResult{Status: http.StatusUnprocessableEntity, Error: err}
+		}
+		if err := dec.Decode(&edit, r.Form); err != nil {
+			return httpResult{Status: http.StatusUnprocessableEntity, Error: err}
+		}
+		d.clean()
+		add := description{Keywords: edit.AddKeywords}
+		remove := description{Keywords: edit.RemoveKeywords}
+		add.clean()
+		remove.clean()
+
+		list, err := loadKeywordList()
+		if err != nil {
+			return httpResult{Error: err}
+		}
+		for i, k := range d.Keywords {
+			d.Keywords[i] = expandKeyword(list, k)
+		}
+		for i, k := range add.Keywords {
+			add.Keywords[i] = expandKeyword(list, k)
+		}
+
+		// only the fields sent are changed
+		var update []string
+		for _, field := range descriptionFields {
+			if _, ok := r.Form[field]; ok {
+				update = append(update, field)
+			}
+		}
+		editing := len(add.Keywords) > 0 || len(remove.Keywords) > 0
+		if len(photos) == 0 || len(update) == 0 && !editing {
+			return httpResult{Status: http.StatusNoContent}
+		}
+
+		results := batchProcess(r.Context(), photos, func(ctx context.Context, photo batchPhoto) error {
+			if !editing {
+				return saveDescription(photo.Path, d, update...)
+			}
+			// add and remove keywords to those of each photo
+			d, update := d, update
+			if !slices.Contains(update, "keywords") {
+				cur, err := loadDescription(photo.Path)
+				if err != nil {
+					return err
+				}
+				d.Keywords = cur.Keywords
+				update = append(slices.Clip(update), "keywords")
+			}
+			d.Keywords = editKeywords(d.Keywords, add.Keywords, remove.Keywords)
+			return saveDescription(photo.Path, d, update...)
+		})
 
 		w.Header().Set("Content-Type", "application/x-ndjson")
 		w.WriteHeader(http.StatusMultiStatus)
 		batchResultWriter(w, results, len(photos))
 		return httpResult{}
 
+	case template:
+		if r := sendAllowed(w, r, "POST"); r.Done() {
+			return r
+		}
+		var t metaTemplate
+		if r := decodeTemplate(&t, r.Form); r.Done() {
+			return r
+		}
+		if len(photos) == 0 {
+			return httpResult{Status: http.StatusNoContent}
+		}
+
+		results := batchProcess(r.Context(), photos, func(ctx context.Context, photo batchPhoto) error {
+			return applyTemplate(photo.Path, t)
+		})
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusMultiStatus)
+		batchResultWriter(w, results, len(photos))
+		return httpResult{}
+
+	case timeshift:
+		if r := sendAllowed(w, r, "GET", "HEAD", "POST"); r.Done() {
+			return r
+		}
+		var shift timeShift
+		dec := schema.NewDecoder()
+		dec.IgnoreUnknownKeys(true)
+		if err := dec.Decode(&shift, r.Form); err != nil {
+			return httpResult{Status: http.StatusUnprocessableEntity, Error: err}
+		}
+
+		paths := make([]string, len(photos))
+		for i, photo := range photos {
+			paths[i] = photo.Path
+		}
+		times, err := loadPhotoTimes(paths)
+		if err != nil {
+			return httpResult{Error: err}
+		}
+		offset, err := shift.offset(photos, times)
+		if err != nil {
+			return httpResult{Status: http.StatusUnprocessableEntity, Message: err.Error()}
+		}
+
+		// GET previews, POST shifts
+		if r.Method != "POST" {
+			preview := make([]timeShiftPreview, len(photos))
+			for i, photo := range photos {
+				preview[i].Name = photo.Name
+				if t := times[photo.Path].original(); !t.IsZero() {
+					preview[i].Old = t.String()
+					preview[i].New = t.add(offset).String()
+				}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(preview); err != nil {
+				return httpResult{Error: err}
+			}
+			return httpResult{}
+		}
+		if len(photos) == 0 || offset == 0 {
+			return httpResult{Status: http.StatusNoContent}
+		}
+
+		results := batchProcess(r.Context(), photos, func(ctx context.Context, photo batchPhoto) error {
+			return shiftTime(photo.Path, times[photo.Path], offset, shift.Originals)
+		})
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusMultiStatus)
+		batchResultWriter(w, results, len(photos))
+		return httpResult{}
+
+	case geotags:
+		if r := sendAllowed(w, r, "POST"); r.Done() {
+			return r
+		}
+		if err := r.ParseMultipartForm(10 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+			return httpResult{Status: http.StatusBadRequest, Error: err}
+		}
+		var gs geotagSettings
+		dec := schema.NewDecoder()
+		dec.IgnoreUnknownKeys(true)
+		if err := dec.Decode(&gs, r.Form); err != nil {
+			return httpResult{Status: http.StatusUnprocessableEntity, Error: err}
+		}
+		loc, err := gs.location()
+		if err != nil {
+			return httpResult{Status: http.StatusUnprocessableEntity, Message: err.Error()}
+		}
+		offset, err := gs.offset()
+		if err != nil {
+			return httpResult{Status: http.StatusUnprocessableEntity, Message: err.Error()}
+		}
+		if gs.Geocode {
+			if _, err := loadGazetteer(); err != nil {
+				return httpResult{Error: err}
+			}
+		}
+		if len(photos) == 0 {
+			return httpResult{Status: http.StatusNoContent}
+		}
+
+		// an uploaded track, a track on the server, or pick one
+		var track string
+		if file, header, err := r.FormFile("track"); err == nil {
+			defer file.Close()
+			track, err = saveTrack(header.Filename, file)
+			if err != nil {
+				return httpResult{Error: err}
+			}
+			defer os.Remove(track)
+		} else if !errors.Is(err, http.ErrMissingFile) && !errors.Is(err, http.ErrNotMultipart) {
+			return httpResult{Status: http.StatusBadRequest, Error: err}
+		} else if gs.TrackPath != "" {
+			track = fromUsrPath(gs.TrackPath, prefix)
+			if fi, err := os.Stat(track); err != nil || !fi.Mode().IsRegular() {
+				return httpResult{Status: http.StatusUnprocessableEntity, Message: "track is not a file: " + gs.TrackPath}
+			}
+		} else if isLocalhost(r) {
+			filter := zenity.FileFilter{Name: "GPS tracks", Patterns: []string{"*.gpx", "*.kml", "*.nmea", "*.log", "*.txt"}, CaseFold: true}
+			if res, err := zenity.SelectFile(zenity.Context(r.Context()), filter, zenity.Filename(filepath.Dir(photos[0].Path))); res != "" {
+				track = res
+			} else if errors.Is(err, zenity.ErrCanceled) {
+				return httpResult{Status: http.StatusNoContent}
+			} else if err == nil {
+				return httpResult{Status: http.StatusInternalServerError}
+			} else {
+				return httpResult{Error: err}
+			}
+		} else {
+			return httpResult{Status: http.StatusUnprocessableEntity, Message: "missing track"}
+		}
+
+		paths := make([]string, len(photos))
+		for i, photo := range photos {
+			paths[i] = photo.Path
+		}
+		times, err := loadPhotoTimes(paths)
+		if err != nil {
+			return httpResult{Error: err}
+		}
+
+		// results name their photos: matched photos are OK, unmatched ones fail
+		results := batchProcess(r.Context(), photos, func(ctx context.Context, photo batchPhoto) error {
+			when, err := geotime(times[photo.Path], offset, loc)
+			if err == nil {
+				err = geotag(photo.Path, track, when)
+			}
+			if err == nil && gs.Geocode {
+				err = reverseGeocode(photo.Path, gs.Overwrite)
+			}
+			return err
+		})
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusMultiStatus)
+		batchResultWriter(w, results, len(photos))
+		return httpResult{}
+
+	case geocode:
+		if r := sendAllowed(w, r, "POST"); r.Done() {
+			return r
+		}
+		overwrite, _ := strconv.ParseBool(r.Form.Get("overwrite"))
+		if _, err := loadGazetteer(); err != nil {
+			return httpResult{Error: err}
+		}
+		if len(photos) == 0 {
+			return httpResult{Status: http.StatusNoContent}
+		}
+
+		results := batchProcess(r.Context(), photos, func(ctx context.Context, photo batchPhoto) error {
+			return reverseGeocode(photo.Path, overwrite)
+		})
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusMultiStatus)
+		batchResultWriter(w, results, len(photos))
+		return httpResult{}
+
+	case compare:
+		photos, err := compareReference(photos, r.Form.Get("reference"))
+		if err != nil {
+			return httpResult{Status: http.StatusUnprocessableEntity, Message: err.Error()}
+		}
+		total := len(photos)
+		photos = photos[:min(len(photos), compareLimit)]
+		paths := make([]string, len(photos))
+		for i, photo := range photos {
+			paths[i] = photo.Path
+		}
+		var rows []compareRow
+		if len(paths) > 0 {
+			rows, err = compareMeta(paths)
+			if err != nil {
+				return httpResult{Error: err}
+			}
+		}
+
+		if r.Form.Get("compare") == "json" {
+			names := make([]string, len(photos))
+			for i, photo := range photos {
+				names[i] = photo.Name
+			}
+			w.Header().Set("Content-Type", "application/json")
+			enc := json.NewEncoder(w)
+			if err := enc.Encode(struct {
+				Photos []string     `json:"photos"`
+				Rows   []compareRow `json:"rows"`
+			}{names, rows}); err != nil {
+				return httpResult{Error: err}
+			}
+			return httpResult{}
+		}
+
+		w.Header().Set("Cache-Control", "max-age=10")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		data := struct {
+			Total  int
+			Photos []struct{ Name, Path string }
+			Rows   []compareRow
+		}{
+			total, nil, rows,
+		}
+		for _, photo := range photos {
+			item := struct{ Name, Path string }{photo.Name, toURLPath(photo.Path, prefix)}
+			data.Photos = append(data.Photos, item)
+		}
+
+		return httpResult{
+			Error: templates.ExecuteTemplate(w, "compare.gohtml", data),
+		}
+
 	case settings:
 		if len(photos) == 0 {
 			return httpResult{Status: http.StatusNoContent}
@@ -124,10 +612,10 @@ func batchHandler(w http.ResponseWriter, r *http.Request) httpResult {
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
 		data := struct {
-			Export bool
+			Server bool
 			Photos []struct{ Name, Path string }
 		}{
-			isLocalhost(r), nil,
+			!isLocalhost(r), nil,
 		}
 
 		for _, photo := range photos {
@@ -141,39 +629,112 @@ func batchHandler(w http.ResponseWriter, r *http.Request) httpResult {
 	}
 }
 
-func batchProcessPhoto(ctx context.Context, photo batchPhoto, exppath string, xmp xmpSettings, exp exportSettings) error {
+func batchProcessPhoto(ctx context.Context, photo batchPhoto, seq int, exppath string, xmp xmpSettings, exp exportSettings) error {
+	names, out, err := batchExportPhoto(ctx, photo, seq, xmp, exp)
+	if err != nil {
+		return err
+	}
+
+	for i, name := range names {
+		if err := writeNewFile(filepath.Join(exppath, name), out[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// batchExportPhoto exports a photo and its renditions.
+// Names are relative to the export directory.
+func batchExportPhoto(ctx context.Context, photo batchPhoto, seq int, xmp xmpSettings, exp exportSettings) ([]string, [][]byte, error) {
+	renditions := exp.renditions()
+	names := make([]string, len(renditions))
+	for i, exp := range renditions {
+		name, err := exportName(photo.Path, photo.Name, seq, exp)
+		if err != nil {
+			return nil, nil, err
+		}
+		names[i] = name
+	}
+
 	xmp.Filename = filepath.Base(photo.Path)
-	out, err := exportEdit(ctx, photo.Path, xmp, exp)
+	out, err := exportEdits(ctx, photo.Path, xmp, exp)
 	if err != nil {
+		return nil, nil, err
+	}
+	return names, out, nil
+}
+
+// batchExportZIP streams exported photos to the client as a ZIP archive.
+// Files are added as they're done; errors are listed in a manifest at the end.
+func batchExportZIP(w http.ResponseWriter, r *http.Request, photos []batchPhoto, seq map[string]int, xmp xmpSettings, exp exportSettings) httpResult {
+	name := "export.zip"
+	if len(photos) > 0 {
+		name = filepath.Base(filepath.Dir(photos[0].Path)) + ".zip"
+	}
+
+	w.Header().Set("Content-Disposition", "attachment; filename*=UTF-8''"+util.PercentEncode(name))
+	w.Header().Set("Content-Type", "application/zip")
+	w.WriteHeader(http.StatusOK)
+
+	zw := newZIPExport(w, len(photos))
+	results := batchProcess(r.Context(), photos, func(ctx context.Context, photo batchPhoto) error {
+		names, out, err := batchExportPhoto(ctx, photo, seq[photo.Path], xmp, exp)
+		if err == nil {
+			err = zw.add(seq[photo.Path], photo.Name, names, out)
+		}
+		if err != nil {
+			zw.fail(seq[photo.Path], photo.Name, err)
+		}
 		return err
+	})
+	for range results {
 	}
 
-	exppath = filepath.Join(exppath, exportPath(photo.Name, exp))
-	if err := os.MkdirAll(filepath.Dir(exppath), 0777); err != nil {
+	zw.close()
+	return httpResult{}
+}
+
+// exportDest resolves a destination directory, given as a user path.
+func exportDest(dest, prefix string) (string, httpResult) {
+	dir := fromUsrPath(dest, prefix)
+	fi, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) || err == nil && !fi.IsDir() {
+		return "", httpResult{Status: http.StatusUnprocessableEntity, Message: "destination is not a directory: " + dest}
+	}
+	if err != nil {
+		return "", httpResult{Error: err}
+	}
+	return dir, httpResult{}
+}
+
+// writeNewFile writes data to a new file, creating directories as needed.
+// If the file already exists, a numeric suffix is appended or incremented.
+func writeNewFile(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
 		return err
 	}
-	f, err := osutil.NewFile(exppath)
+	f, err := osutil.NewFile(name)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	_, err = f.Write(out)
+	_, err = f.Write(data)
 	if err != nil {
 		return err
 	}
 	return f.Close()
 }
 
-func batchResultWriter(w http.ResponseWriter, results <-chan error, total int) {
+func batchResultWriter(w http.ResponseWriter, results <-chan batchResult, total int) {
 	i := 0
 	enc := json.NewEncoder(w)
 	flush, _ := w.(http.Flusher)
-	for err := range results {
+	for res := range results {
 		i += 1
-		var status multiStatus
-		if err != nil {
-			status.Code, status.Body = errorStatus(err)
+		status := multiStatus{Photo: res.photo.Name}
+		if res.err != nil {
+			status.Code, status.Body = errorStatus(res.err)
 		} else {
 			status.Code = http.StatusOK
 		}
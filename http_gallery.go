@@ -1,41 +1,77 @@
 package main
 
 import (
+	"bytes"
+	"html/template"
 	"io/fs"
+	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/gorilla/schema"
 	"github.com/ncruces/jason"
 	"github.com/ncruces/rethinkraw/pkg/osutil"
 )
 
+type galleryItem struct {
+	Name, Path string
+	Edited     bool
+	Culling    culling
+	Siblings   []string // RAW+JPEG and sidecars
+	Stack      int      // 1-based, for stacks of more than one photo
+	StackSize  int      // for the cover of a stack
+	file       string
+	meta       *galleryMeta
+}
+
 func galleryHandler(w http.ResponseWriter, r *http.Request) httpResult {
 	if r := sendAllowed(w, r, "GET", "HEAD"); r.Done() {
 		return r
 	}
+	if err := r.ParseForm(); err != nil {
+		return httpResult{Status: http.StatusBadRequest, Error: err}
+	}
 	prefix := getPathPrefix(r)
 	path := fromURLPath(r.URL.Path, prefix)
 
-	w.Header().Set("Cache-Control", "max-age=10")
-	if r := sendCached(w, r, path); r.Done() {
-		return r
+	var query galleryQuery
+	dec := schema.NewDecoder()
+	dec.IgnoreUnknownKeys(true)
+	if err := dec.Decode(&query, r.Form); err != nil {
+		return httpResult{Status: http.StatusBadRequest, Error: err}
+	}
+	if err := query.validate(); err != nil {
+		return httpResult{Status: http.StatusBadRequest, Error: err}
 	}
 
+	// no conditional requests: ratings and edits change sidecars, not the folder
+	w.Header().Set("Cache-Control", "max-age=10")
+
 	if files, err := os.ReadDir(path); err != nil {
 		return httpResult{Error: err}
 	} else {
 		data := struct {
 			Upload       bool
 			Title, Path  string
-			Dirs, Photos []struct{ Name, Path string }
+			Dirs, Photos []galleryItem
+			Query        galleryQuery
+			Filtered     bool
+			Total        int
+			Page, Pages  int
+			Prev, Next   template.URL
 			JSON         jason.Object
 		}{
-			!isLocalhost(r),
-			toUsrPath(path, prefix),
-			toURLPath(path, prefix),
-			nil, nil, jason.Object{},
+			Upload: !isLocalhost(r),
+			Title:  toUsrPath(path, prefix),
+			Path:   toURLPath(path, prefix),
+			Query:  query,
+			JSON:   jason.Object{},
 		}
 		if data.Upload {
 			data.JSON["uploadPath"] = data.Path
@@ -45,13 +81,13 @@ func galleryHandler(w http.ResponseWriter, r *http.Request) httpResult {
 		for _, entry := range files {
 			name := entry.Name()
 			path := filepath.Join(path, name)
-			item := struct{ Name, Path string }{name, toURLPath(path, prefix)}
+			item := galleryItem{Name: name, Path: toURLPath(path, prefix), file: path}
 
 			if osutil.HiddenFile(entry) {
 				continue
 			}
 			if entry.Type().IsRegular() {
-				if _, ok := extensions[strings.ToUpper(filepath.Ext(name))]; ok {
+				if _, ok := extensions[strings.ToUpper(filepath.Ext(name))]; ok && !query.Recursive {
 					data.Photos = append(data.Photos, item)
 				}
 				continue
@@ -68,9 +104,172 @@ func galleryHandler(w http.ResponseWriter, r *http.Request) httpResult {
 			}
 		}
 
+		if query.Recursive {
+			photos, err := findPhotos([]string{path})
+			if err != nil {
+				return httpResult{Error: err}
+			}
+			for _, photo := range photos {
+				data.Photos = append(data.Photos, galleryItem{
+					Name: photo.Name,
+					Path: toURLPath(photo.Path, prefix),
+					file: photo.Path,
+				})
+			}
+		}
+
+		data.Total = len(data.Photos)
+		if query.needsSidecar() {
+			loadGallerySidecars(data.Photos)
+		}
+		if query.needsMeta() {
+			var paths []string
+			for _, item := range data.Photos {
+				paths = append(paths, item.file)
+			}
+			metas, err := loadGalleryMeta(paths)
+			if err != nil {
+				return httpResult{Error: err}
+			}
+			for i := range data.Photos {
+				data.Photos[i].meta = metas[data.Photos[i].file]
+			}
+		}
+		if query.filtered() {
+			data.Filtered = true
+			data.Photos = slices.DeleteFunc(data.Photos, func(item galleryItem) bool {
+				return !query.match(&item)
+			})
+		}
+		query.sort(data.Photos)
+
+		var stacks [][]galleryItem
+		if query.Stack != "" {
+			var hashes map[string]uint64
+			if query.Stack == "similar" {
+				var paths []string
+				for _, item := range data.Photos {
+					paths = append(paths, item.file)
+				}
+				hashes = loadGalleryHashes(paths)
+			}
+			gap := time.Duration(query.Gap * float64(time.Second))
+			stacks = stackItems(data.Photos, query.Stack, gap, hashes)
+		} else {
+			for _, item := range data.Photos {
+				stacks = append(stacks, []galleryItem{item})
+			}
+		}
+
+		// only a page of photos (or stacks) is rendered
+		data.Pages = max(1, (len(stacks)+galleryPageSize-1)/galleryPageSize)
+		data.Page = min(max(1, query.Page), data.Pages)
+		start := (data.Page - 1) * galleryPageSize
+		data.Photos = nil
+		for i, stack := range stacks[start:min(start+galleryPageSize, len(stacks))] {
+			if len(stack) > 1 {
+				cover := stackCover(stack)
+				for j := range stack {
+					stack[j].Stack = start + i + 1
+				}
+				stack[cover].StackSize = len(stack)
+			}
+			data.Photos = append(data.Photos, stack...)
+		}
+		if data.Page > 1 {
+			data.Prev = pageURL(r.URL.Query(), data.Page-1)
+		}
+		if data.Page < data.Pages {
+			data.Next = pageURL(r.URL.Query(), data.Page+1)
+		}
+
+		if !query.needsSidecar() {
+			loadGallerySidecars(data.Photos)
+		}
+		var paths []string
+		for _, item := range data.Photos {
+			paths = append(paths, item.file)
+		}
+		if siblings, err := findSiblings(paths); err == nil {
+			for i, item := range data.Photos {
+				for _, path := range siblings[item.file] {
+					data.Photos[i].Siblings = append(data.Photos[i].Siblings, filepath.Base(path))
+				}
+			}
+		}
+		if r.Method == "GET" {
+			pregenThumbs(path, paths)
+			catalogUpdate(path, query.Recursive)
+		}
+
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		return httpResult{
 			Error: templates.ExecuteTemplate(w, "gallery.gohtml", data),
 		}
 	}
 }
+
+// galleryPageSize is the number of photos rendered per page.
+const galleryPageSize = 200
+
+func pageURL(query url.Values, page int) template.URL {
+	if page > 1 {
+		query.Set("page", strconv.Itoa(page))
+	} else {
+		query.Del("page")
+	}
+	return template.URL("?" + query.Encode())
+}
+
+// loadGallerySidecars loads the culling and edits of items,
+// from the catalog, if enabled, or from each sidecar.
+func loadGallerySidecars(items []galleryItem) {
+	if catalog != nil {
+		paths := make([]string, len(items))
+		for i, item := range items {
+			paths[i] = item.file
+		}
+		entries, err := catalog.load(paths)
+		if err == nil {
+			for i := range items {
+				if e := entries[items[i].file]; e != nil {
+					items[i].Edited = e.Edited
+					items[i].Culling = e.Culling
+				}
+			}
+			return
+		}
+		log.Print("catalog: ", err)
+	}
+	for i := range items {
+		items[i].loadSidecar()
+	}
+}
+
+// loadSidecar takes a look at the sidecar, or the XMP embedded in an edited DNG.
+func (item *galleryItem) loadSidecar() {
+	if data, err := readSidecar(item.file); err == nil && data != nil {
+		item.Edited = hasCameraRawSettings(bytes.NewReader(data))
+		item.Culling = parseCulling(data)
+	}
+}
+
+// Group describes the siblings of a photo, like "+JPEG +XMP".
+func (item *galleryItem) Group() string {
+	var jpeg, xmp bool
+	for _, name := range item.Siblings {
+		if strings.EqualFold(filepath.Ext(name), ".xmp") {
+			xmp = true
+		} else {
+			jpeg = true
+		}
+	}
+	var group []string
+	if jpeg {
+		group = append(group, "+JPEG")
+	}
+	if xmp {
+		group = append(group, "+XMP")
+	}
+	return strings.Join(group, " ")
+}
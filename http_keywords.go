@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+func keywordsHandler(w http.ResponseWriter, r *http.Request) httpResult {
+	if r := sendAllowed(w, r, "GET", "HEAD", "POST"); r.Done() {
+		return r
+	}
+	if err := r.ParseMultipartForm(10 << 20); err != nil && err != http.ErrNotMultipart {
+		return httpResult{Status: http.StatusBadRequest, Error: err}
+	}
+
+	list, err := loadKeywordList()
+	if err != nil {
+		return httpResult{Error: err}
+	}
+
+	switch r.Method {
+	case "POST":
+		// import a keyword list file, or add keywords
+		var paths []string
+		if r.MultipartForm != nil && len(r.MultipartForm.File["file"]) > 0 {
+			f, err := r.MultipartForm.File["file"][0].Open()
+			if err != nil {
+				return httpResult{Error: err}
+			}
+			paths, err = parseKeywordList(f)
+			f.Close()
+			if err != nil {
+				return httpResult{Status: http.StatusUnprocessableEntity, Error: err}
+			}
+		}
+		d := description{Keywords: r.Form["keywords"]}
+		d.clean()
+		paths = append(paths, d.Keywords...)
+
+		if replace, _ := strconv.ParseBool(r.Form.Get("replace")); replace {
+			list = nil
+		}
+		if err := saveKeywordList(mergeKeywords(list, paths)); err != nil {
+			return httpResult{Error: err}
+		}
+		return httpResult{Status: http.StatusNoContent}
+
+	default:
+		if _, export := r.Form["export"]; export {
+			w.Header().Set("Content-Disposition", `attachment; filename="keywords.txt"`)
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write(formatKeywordList(list))
+			return httpResult{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if list == nil {
+			list = []string{}
+		}
+		if err := json.NewEncoder(w).Encode(list); err != nil {
+			return httpResult{Error: err}
+		}
+		return httpResult{}
+	}
+}
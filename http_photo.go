@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/gorilla/schema"
 	"github.com/ncruces/jason"
@@ -22,6 +23,9 @@ func photoHandler(w http.ResponseWriter, r *http.Request) httpResult {
 
 	_, meta := r.Form["meta"]
 	_, save := r.Form["save"]
+	_, cull := r.Form["cull"]
+	_, describe := r.Form["describe"]
+	_, template := r.Form["template"]
 	_, export := r.Form["export"]
 	_, preview := r.Form["preview"]
 	_, settings := r.Form["settings"]
@@ -34,6 +38,9 @@ func photoHandler(w http.ResponseWriter, r *http.Request) httpResult {
 			return r
 		}
 
+		if r.Form.Get("meta") == "json" {
+			return sendMetaJSON(w, []string{path}, r.Form["tags"], prefix, true)
+		}
 		if out, err := getMetaHTML(path); err != nil {
 			return httpResult{Error: err}
 		} else {
@@ -57,6 +64,92 @@ func photoHandler(w http.ResponseWriter, r *http.Request) httpResult {
 			return httpResult{Status: http.StatusNoContent}
 		}
 
+	case cull:
+		if r := sendAllowed(w, r, "POST"); r.Done() {
+			return r
+		}
+		c, err := loadCulling(path)
+		if err != nil {
+			return httpResult{Error: err}
+		}
+		dec := schema.NewDecoder()
+		dec.IgnoreUnknownKeys(true)
+		if err := dec.Decode(&c, r.Form); err != nil {
+			return httpResult{Status: http.StatusUnprocessableEntity, Error: err}
+		}
+		if err := c.validate(); err != nil {
+			return httpResult{Status: http.StatusUnprocessableEntity, Error: err}
+		}
+
+		var update []string
+		for _, field := range []string{"rating", "label", "flag"} {
+			if _, ok := r.Form[field]; ok {
+				update = append(update, field)
+			}
+		}
+		if err := saveCulling(path, c, update...); err != nil {
+			return httpResult{Error: err}
+		}
+		return httpResult{Status: http.StatusNoContent}
+
+	case describe:
+		if r := sendAllowed(w, r, "GET", "HEAD", "POST"); r.Done() {
+			return r
+		}
+		d, err := loadDescription(path)
+		if err != nil {
+			return httpResult{Error: err}
+		}
+
+		if r.Method != "POST" {
+			w.Header().Set("Content-Type", "application/json")
+			enc := json.NewEncoder(w)
+			if err := enc.Encode(d); err != nil {
+				return httpResult{Error: err}
+			}
+			return httpResult{}
+		}
+
+		dec := schema.NewDecoder()
+		dec.IgnoreUnknownKeys(true)
+		if err := dec.Decode(&d, r.Form); err != nil {
+			return httpResult{Status: http.StatusUnprocessableEntity, Error: err}
+		}
+		d.clean()
+
+		var update []string
+		for _, field := range descriptionFields {
+			if _, ok := r.Form[field]; ok {
+				update = append(update, field)
+			}
+		}
+		if _, ok := r.Form["keywords"]; ok {
+			list, err := loadKeywordList()
+			if err != nil {
+				return httpResult{Error: err}
+			}
+			for i, k := range d.Keywords {
+				d.Keywords[i] = expandKeyword(list, k)
+			}
+		}
+		if err := saveDescription(path, d, update...); err != nil {
+			return httpResult{Error: err}
+		}
+		return httpResult{Status: http.StatusNoContent}
+
+	case template:
+		if r := sendAllowed(w, r, "POST"); r.Done() {
+			return r
+		}
+		var t metaTemplate
+		if r := decodeTemplate(&t, r.Form); r.Done() {
+			return r
+		}
+		if err := applyTemplate(path, t); err != nil {
+			return httpResult{Error: err}
+		}
+		return httpResult{Status: http.StatusNoContent}
+
 	case export:
 		var xmp xmpSettings
 		var exp exportSettings
@@ -65,13 +158,23 @@ func photoHandler(w http.ResponseWriter, r *http.Request) httpResult {
 		if err := dec.Decode(&xmp, r.Form); err != nil {
 			return httpResult{Error: err}
 		}
-		if err := dec.Decode(&exp, r.Form); err != nil {
-			return httpResult{Error: err}
+		if r := decodeExport(&exp, r.Form); r.Done() {
+			return r
 		}
 		xmp.Filename = filepath.Base(path)
 
-		exppath := exportPath(path, exp)
-		if isLocalhost(r) {
+		exppath, err := exportName(path, path, 1, exp)
+		if err != nil {
+			return httpResult{Error: err}
+		}
+		dest := r.Form.Get("dest")
+		if dest != "" {
+			dir, res := exportDest(dest, prefix)
+			if res.Done() {
+				return res
+			}
+			exppath = filepath.Join(dir, filepath.Base(exppath))
+		} else if isLocalhost(r) {
 			if res, err := zenity.SelectFileSave(zenity.Context(r.Context()), zenity.Filename(exppath), zenity.ConfirmOverwrite()); res != "" {
 				exppath = res
 			} else if errors.Is(err, zenity.ErrCanceled) {
@@ -83,24 +186,57 @@ func photoHandler(w http.ResponseWriter, r *http.Request) httpResult {
 			}
 		}
 
-		if out, err := exportEdit(r.Context(), path, xmp, exp); err != nil {
-			return httpResult{Error: err}
-		} else if isLocalhost(r) {
-			if err := os.WriteFile(exppath, out, 0666); err != nil {
+		if dest != "" || isLocalhost(r) {
+			out, err := exportEdits(r.Context(), path, xmp, exp)
+			if err != nil {
 				return httpResult{Error: err}
+			}
+			if dest != "" {
+				// never overwrite server files
+				err = writeNewFile(exppath, out[0])
 			} else {
-				return httpResult{Status: http.StatusNoContent}
+				err = os.WriteFile(exppath, out[0], 0666)
 			}
-		} else {
-			name := filepath.Base(exppath)
+			if err != nil {
+				return httpResult{Error: err}
+			}
+			// renditions go next to the export
+			for i, exp := range exp.renditions()[1:] {
+				name, err := exportName(path, path, 1, exp)
+				if err != nil {
+					return httpResult{Error: err}
+				}
+				name = filepath.Join(filepath.Dir(exppath), filepath.Base(name))
+				if err := writeNewFile(name, out[i+1]); err != nil {
+					return httpResult{Error: err}
+				}
+			}
+			return httpResult{Status: http.StatusNoContent}
+		} else if len(exp.renditions()) > 1 {
+			// several files are sent as a ZIP archive
+			photo := batchPhoto{Path: path, Name: filepath.Base(path)}
+			names, out, err := batchExportPhoto(r.Context(), photo, 1, xmp, exp)
+			if err != nil {
+				return httpResult{Error: err}
+			}
+			name := strings.TrimSuffix(filepath.Base(exppath), filepath.Ext(exppath)) + ".zip"
 			w.Header().Set("Content-Disposition", "attachment; filename*=UTF-8''"+util.PercentEncode(name))
-			if exp.DNG {
-				w.Header().Set("Content-Type", "image/x-adobe-dng")
+			w.Header().Set("Content-Type", "application/zip")
+			zw := newZIPExport(w, 1)
+			if err := zw.add(1, photo.Name, names, out); err != nil {
+				return httpResult{Error: err}
+			}
+			return httpResult{Error: zw.close()}
+		} else {
+			if out, err := exportEdit(r.Context(), path, xmp, exp); err != nil {
+				return httpResult{Error: err}
 			} else {
-				w.Header().Set("Content-Type", "image/jpeg")
+				name := filepath.Base(exppath)
+				w.Header().Set("Content-Disposition", "attachment; filename*=UTF-8''"+util.PercentEncode(name))
+				w.Header().Set("Content-Type", exportType(exp))
+				w.Write(out)
+				return httpResult{}
 			}
-			w.Write(out)
-			return httpResult{}
 		}
 
 	case preview:
@@ -125,10 +261,15 @@ func photoHandler(w http.ResponseWriter, r *http.Request) httpResult {
 	case settings:
 		if xmp, err := loadEdit(path); err != nil {
 			return httpResult{Error: err}
+		} else if cull, err := loadCulling(path); err != nil {
+			return httpResult{Error: err}
 		} else {
 			w.Header().Set("Content-Type", "application/json")
 			enc := json.NewEncoder(w)
-			if err := enc.Encode(xmp); err != nil {
+			if err := enc.Encode(struct {
+				xmpSettings
+				culling
+			}{xmp, cull}); err != nil {
 				return httpResult{Error: err}
 			}
 		}
@@ -161,10 +302,43 @@ func photoHandler(w http.ResponseWriter, r *http.Request) httpResult {
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		return httpResult{
 			Error: templates.ExecuteTemplate(w, "photo.gohtml", jason.Object{
-				"Title": toUsrPath(path, prefix),
-				"Path":  toURLPath(path, prefix),
-				"Name":  filepath.Base(path),
+				"Title":  toUsrPath(path, prefix),
+				"Path":   toURLPath(path, prefix),
+				"Name":   filepath.Base(path),
+				"Server": !isLocalhost(r),
 			}),
 		}
 	}
 }
+
+// sendMetaJSON sends the metadata of photos as JSON: an array, or an object if single.
+// SourceFile is a user path.
+func sendMetaJSON(w http.ResponseWriter, paths, tags []string, prefix string, single bool) httpResult {
+	metas, err := getMetaJSON(paths, tags...)
+	if errors.Is(err, errInvalidTag) {
+		return httpResult{Status: http.StatusUnprocessableEntity, Message: err.Error()}
+	}
+	if err != nil {
+		return httpResult{Error: err}
+	}
+	for _, meta := range metas {
+		var file string
+		json.Unmarshal(meta["SourceFile"], &file)
+		meta["SourceFile"], _ = json.Marshal(toUsrPath(filepath.FromSlash(file), prefix))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	if single {
+		if len(metas) == 0 {
+			return httpResult{Status: http.StatusNotFound}
+		}
+		err = enc.Encode(metas[0])
+	} else {
+		err = enc.Encode(metas)
+	}
+	if err != nil {
+		return httpResult{Error: err}
+	}
+	return httpResult{}
+}
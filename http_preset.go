@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/schema"
+)
+
+// Export presets are saved to DataDir as: "presets/NAME.json".
+var presets = dataStore("presets")
+
+func presetHandler(w http.ResponseWriter, r *http.Request) httpResult {
+	if r := sendAllowed(w, r, "GET", "HEAD", "POST", "DELETE"); r.Done() {
+		return r
+	}
+	if err := r.ParseForm(); err != nil {
+		return httpResult{Status: http.StatusBadRequest, Error: err}
+	}
+	name := r.Form.Get("name")
+
+	switch r.Method {
+	case "POST":
+		var exp exportSettings
+		form := r.Form
+		form.Del("preset")
+		if r := decodeExport(&exp, form); r.Done() {
+			return r
+		}
+		if err := presets.save(name, exp); errors.Is(err, errInvalidName) {
+			return httpResult{Status: http.StatusUnprocessableEntity, Message: err.Error()}
+		} else if err != nil {
+			return httpResult{Error: err}
+		}
+		return httpResult{Status: http.StatusNoContent}
+
+	case "DELETE":
+		if err := presets.delete(name); errors.Is(err, errInvalidName) {
+			return httpResult{Status: http.StatusUnprocessableEntity, Message: err.Error()}
+		} else if err != nil {
+			return httpResult{Error: err}
+		}
+		return httpResult{Status: http.StatusNoContent}
+
+	default:
+		names, err := presets.list()
+		if err != nil {
+			return httpResult{Error: err}
+		}
+
+		res := map[string]exportSettings{}
+		for _, name := range names {
+			var exp exportSettings
+			if err := presets.load(name, &exp); err == nil {
+				res[name] = exp
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			return httpResult{Error: err}
+		}
+		return httpResult{}
+	}
+}
+
+// decodeExport decodes export settings from a form,
+// unless the form names a preset, which is loaded instead.
+func decodeExport(exp *exportSettings, form url.Values) httpResult {
+	if name := form.Get("preset"); name != "" {
+		if err := presets.load(name, exp); errors.Is(err, fs.ErrNotExist) || errors.Is(err, errInvalidName) {
+			return httpResult{Status: http.StatusUnprocessableEntity, Message: "unknown export preset: " + name}
+		} else if err != nil {
+			return httpResult{Error: err}
+		}
+	} else {
+		dec := schema.NewDecoder()
+		dec.IgnoreUnknownKeys(true)
+		if err := dec.Decode(exp, form); err != nil {
+			return httpResult{Error: err}
+		}
+	}
+
+	if err := exp.validate(); err != nil {
+		return httpResult{Status: http.StatusUnprocessableEntity, Message: err.Error()}
+	}
+	return httpResult{}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/ncruces/rethinkraw/internal/config"
+)
+
+func Test_decodeExport(t *testing.T) {
+	dir := config.DataDir
+	config.DataDir = t.TempDir()
+	t.Cleanup(func() { config.DataDir = dir })
+
+	saved := exportSettings{Resample: true, Quality: 8, Fit: "dims", Long: 1024, Metadata: metaNoLocation}
+	if err := presets.save("web", saved); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		form   url.Values
+		want   exportSettings
+		status int
+	}{
+		{"inline", url.Values{"dng": {"1"}, "preview": {"p1"}}, exportSettings{DNG: true, Preview: "p1"}, 0},
+		{"preset", url.Values{"preset": {"web"}, "dng": {"1"}}, saved, 0},
+		{"unknown", url.Values{"preset": {"print"}}, exportSettings{}, http.StatusUnprocessableEntity},
+		{"invalid name", url.Values{"preset": {"../web"}}, exportSettings{}, http.StatusUnprocessableEntity},
+		{"invalid", url.Values{"metadata": {"some"}}, exportSettings{}, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got exportSettings
+			r := decodeExport(&got, tt.form)
+			if r.Status != tt.status || r.Error != nil {
+				t.Fatalf("decodeExport() = %v", r)
+			}
+			if r.Done() {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeExport() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// searchLimit is the number of results rendered.
+const searchLimit = 500
+
+// searchWait is how long a search waits for the index to be updated.
+const searchWait = 2 * time.Second
+
+func searchHandler(w http.ResponseWriter, r *http.Request) httpResult {
+	if r := sendAllowed(w, r, "GET", "HEAD"); r.Done() {
+		return r
+	}
+	if err := r.ParseForm(); err != nil {
+		return httpResult{Status: http.StatusBadRequest, Error: err}
+	}
+	prefix := getPathPrefix(r)
+	root := fromURLPath(r.URL.Path, prefix)
+
+	if fi, err := os.Stat(root); err != nil {
+		return httpResult{Error: err}
+	} else if !fi.IsDir() {
+		return httpResult{Status: http.StatusNotFound}
+	}
+
+	query := r.Form.Get("q")
+	data := struct {
+		Title, Path, Query string
+		Photos             []galleryItem
+		Total, Indexed     int
+		Updating           bool
+	}{
+		Title: toUsrPath(root, prefix),
+		Path:  toURLPath(root, prefix),
+		Query: query,
+	}
+
+	// answer from the last index, unless it's quickly updated
+	idx := getSearchIndex(root)
+	select {
+	case <-idx.refresh():
+	case <-time.After(searchWait):
+		data.Updating = true
+	case <-r.Context().Done():
+		return httpResult{Error: r.Context().Err()}
+	}
+
+	if query != "" {
+		results := idx.search(query)
+		data.Total = len(results)
+		for _, rel := range results[:min(searchLimit, len(results))] {
+			path := filepath.Join(root, rel)
+			data.Photos = append(data.Photos, galleryItem{
+				Name: filepath.ToSlash(rel),
+				Path: toURLPath(path, prefix),
+				file: path,
+			})
+		}
+	}
+	data.Indexed = idx.size()
+
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return httpResult{
+		Error: templates.ExecuteTemplate(w, "search.gohtml", data),
+	}
+}
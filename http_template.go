@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/schema"
+)
+
+func templateHandler(w http.ResponseWriter, r *http.Request) httpResult {
+	if r := sendAllowed(w, r, "GET", "HEAD", "POST", "DELETE"); r.Done() {
+		return r
+	}
+	if err := r.ParseForm(); err != nil {
+		return httpResult{Status: http.StatusBadRequest, Error: err}
+	}
+	name := r.Form.Get("name")
+
+	switch r.Method {
+	case "POST":
+		var t metaTemplate
+		form := r.Form
+		form.Del("template")
+		if r := decodeTemplate(&t, form); r.Done() {
+			return r
+		}
+		if err := metaTemplates.save(name, t); errors.Is(err, errInvalidName) {
+			return httpResult{Status: http.StatusUnprocessableEntity, Message: err.Error()}
+		} else if err != nil {
+			return httpResult{Error: err}
+		}
+		return httpResult{Status: http.StatusNoContent}
+
+	case "DELETE":
+		if err := metaTemplates.delete(name); errors.Is(err, errInvalidName) {
+			return httpResult{Status: http.StatusUnprocessableEntity, Message: err.Error()}
+		} else if err != nil {
+			return httpResult{Error: err}
+		}
+		return httpResult{Status: http.StatusNoContent}
+
+	default:
+		names, err := metaTemplates.list()
+		if err != nil {
+			return httpResult{Error: err}
+		}
+
+		res := map[string]metaTemplate{}
+		for _, name := range names {
+			var t metaTemplate
+			if err := metaTemplates.load(name, &t); err == nil {
+				res[name] = t
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			return httpResult{Error: err}
+		}
+		return httpResult{}
+	}
+}
+
+// decodeTemplate decodes a metadata template from a form,
+// unless the form names a saved template, which is loaded instead.
+func decodeTemplate(t *metaTemplate, form url.Values) httpResult {
+	if name := form.Get("template"); name != "" {
+		if err := metaTemplates.load(name, t); errors.Is(err, fs.ErrNotExist) || errors.Is(err, errInvalidName) {
+			return httpResult{Status: http.StatusUnprocessableEntity, Message: "unknown metadata template: " + name}
+		} else if err != nil {
+			return httpResult{Error: err}
+		}
+	} else {
+		dec := schema.NewDecoder()
+		dec.IgnoreUnknownKeys(true)
+		if err := dec.Decode(t, form); err != nil {
+			return httpResult{Status: http.StatusUnprocessableEntity, Error: err}
+		}
+	}
+
+	if err := t.validate(); err != nil {
+		return httpResult{Status: http.StatusUnprocessableEntity, Message: err.Error()}
+	}
+	return httpResult{}
+}
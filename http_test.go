@@ -1,6 +1,9 @@
 package main
 
-import "testing"
+import (
+	"path/filepath"
+	"testing"
+)
 
 func Test_getAppDomain(t *testing.T) {
 	tests := []struct {
@@ -25,3 +28,27 @@ func Test_getAppDomain(t *testing.T) {
 		}
 	}
 }
+
+func Test_fromUsrPath(t *testing.T) {
+	if filepath.Separator != '/' {
+		t.Skip()
+	}
+	tests := []struct {
+		path   string
+		prefix string
+		want   string
+	}{
+		{"/photos", "", "/photos"},
+		{"/photos/../raw", "", "/raw"},
+		{"/", "/srv", "/srv"},
+		{"/photos", "/srv", "/srv/photos"},
+		{"photos/2024/", "/srv", "/srv/photos/2024"},
+		{"/../etc", "/srv", "/srv/etc"},
+		{"/photos/../../etc", "/srv", "/srv/etc"},
+	}
+	for _, tt := range tests {
+		if got := fromUsrPath(tt.path, tt.prefix); got != tt.want {
+			t.Errorf("fromUsrPath(%q, %q) = %q, want %q", tt.path, tt.prefix, got, tt.want)
+		}
+	}
+}
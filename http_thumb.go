@@ -1,6 +1,9 @@
 package main
 
-import "net/http"
+import (
+	"net/http"
+	"strconv"
+)
 
 func thumbHandler(w http.ResponseWriter, r *http.Request) httpResult {
 	if r := sendAllowed(w, r, "GET", "HEAD"); r.Done() {
@@ -10,7 +13,7 @@ func thumbHandler(w http.ResponseWriter, r *http.Request) httpResult {
 	path := fromURLPath(r.URL.Path, prefix)
 
 	w.Header().Set("Cache-Control", "max-age=10")
-	if r := sendCached(w, r, path); r.Done() {
+	if r := sendCached(w, r, path, findSidecar(path)...); r.Done() {
 		return r
 	}
 
@@ -19,7 +22,12 @@ func thumbHandler(w http.ResponseWriter, r *http.Request) httpResult {
 		return httpResult{}
 	}
 
-	if out, err := previewJPEG(r.Context(), path); err != nil {
+	size := thumbSize
+	if s, err := strconv.Atoi(r.FormValue("size")); err == nil {
+		size = min(max(s, 64), 2048)
+	}
+
+	if out, err := cachedThumb(r.Context(), path, size); err != nil {
 		return httpResult{Error: err}
 	} else {
 		w.Write(out)
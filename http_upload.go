@@ -2,10 +2,12 @@ package main
 
 import (
 	"io"
+	"log"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 func uploadHandler(w http.ResponseWriter, r *http.Request) httpResult {
@@ -71,5 +73,11 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) httpResult {
 	if err != nil {
 		return httpResult{Error: err}
 	}
+	if _, ok := extensions[strings.ToUpper(filepath.Ext(path))]; ok {
+		if err := applyUploadTemplates(path); err != nil {
+			log.Print("templates: ", err)
+		}
+	}
+	catalogUpdate(path, false)
 	return httpResult{Status: http.StatusOK}
 }
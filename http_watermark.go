@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image/png"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/schema"
+)
+
+func watermarkHandler(w http.ResponseWriter, r *http.Request) httpResult {
+	if r := sendAllowed(w, r, "GET", "HEAD", "POST", "DELETE"); r.Done() {
+		return r
+	}
+	if err := r.ParseMultipartForm(10 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return httpResult{Status: http.StatusBadRequest, Error: err}
+	}
+	name := r.FormValue("name")
+
+	switch r.Method {
+	case "POST":
+		var ws watermarkSettings
+		dec := schema.NewDecoder()
+		dec.IgnoreUnknownKeys(true)
+		if err := dec.Decode(&ws, r.Form); err != nil {
+			return httpResult{Status: http.StatusBadRequest, Error: err}
+		}
+		ws.Name = ""
+
+		if file, _, err := r.FormFile("logo"); err == nil {
+			defer file.Close()
+			data, err := io.ReadAll(file)
+			if err != nil {
+				return httpResult{Error: err}
+			}
+			if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+				return httpResult{Status: http.StatusUnprocessableEntity, Message: "logo: " + err.Error()}
+			}
+			path, err := watermarks.path(name, ".png")
+			if err != nil {
+				return httpResult{Status: http.StatusUnprocessableEntity, Message: err.Error()}
+			}
+			if err := watermarks.write(path, data); err != nil {
+				return httpResult{Error: err}
+			}
+			ws.Logo = name
+		} else if !errors.Is(err, http.ErrMissingFile) && !errors.Is(err, http.ErrNotMultipart) {
+			return httpResult{Status: http.StatusBadRequest, Error: err}
+		}
+
+		if err := watermarks.save(name, ws); errors.Is(err, errInvalidName) {
+			return httpResult{Status: http.StatusUnprocessableEntity, Message: err.Error()}
+		} else if err != nil {
+			return httpResult{Error: err}
+		}
+		return httpResult{Status: http.StatusNoContent}
+
+	case "DELETE":
+		if err := watermarks.delete(name, ".png"); errors.Is(err, errInvalidName) {
+			return httpResult{Status: http.StatusUnprocessableEntity, Message: err.Error()}
+		} else if err != nil {
+			return httpResult{Error: err}
+		}
+		return httpResult{Status: http.StatusNoContent}
+
+	default:
+		names, err := watermarks.list()
+		if err != nil {
+			return httpResult{Error: err}
+		}
+
+		res := map[string]watermarkSettings{}
+		for _, name := range names {
+			var ws watermarkSettings
+			if err := watermarks.load(name, &ws); err == nil {
+				res[name] = ws
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			return httpResult{Error: err}
+		}
+		return httpResult{}
+	}
+}
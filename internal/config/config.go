@@ -14,6 +14,7 @@ import (
 var (
 	ServerMode                bool
 	BaseDir, DataDir, TempDir string
+	GeoNamesDir               string
 )
 
 func init() {
@@ -39,11 +40,13 @@ func SetupPaths() (err error) {
 		exiftool.Exec = BaseDir + `\utils\exiftool\exiftool.exe`
 		exiftool.Arg1 = strings.TrimSuffix(exiftool.Exec, ".exe")
 		exiftool.Config = BaseDir + `\utils\exiftool_config.pl`
+		GeoNamesDir = BaseDir + `\utils\geonames`
 	} else {
 		ServerMode = name == "rethinkraw-server"
 		dcraw.Path = BaseDir + "/utils/dcraw.wasm"
 		exiftool.Exec = BaseDir + "/utils/exiftool/exiftool"
 		exiftool.Config = BaseDir + "/utils/exiftool_config.pl"
+		GeoNamesDir = BaseDir + "/utils/geonames"
 	}
 
 	if testDataDir() == nil {
@@ -5,13 +5,16 @@ import (
 	"context"
 	"encoding/binary"
 	"errors"
+	"image"
 	"image/jpeg"
+	"io"
 	"log"
 	"os"
 
 	"github.com/ncruces/go-image/resize"
 	"github.com/ncruces/go-image/rotateflip"
 	"github.com/ncruces/rethinkraw/pkg/dcraw"
+	"golang.org/x/image/tiff"
 )
 
 func previewJPEG(ctx context.Context, path string) ([]byte, error) {
@@ -24,6 +27,43 @@ func previewJPEG(ctx context.Context, path string) ([]byte, error) {
 	return dcraw.GetThumbJPEG(ctx, f)
 }
 
+// thumbImage returns the upright thumbnail embedded in a RAW file.
+func thumbImage(ctx context.Context, path string) (image.Image, error) {
+	log.Print("dcraw (get thumb)...")
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := dcraw.GetThumb(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte("\xff\xd8")) {
+		// not a JPEG, convert it upright
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		data, err = dcraw.GetThumbJPEG(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+		return jpeg.Decode(bytes.NewReader(data))
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	// the RAW orientation prevails over that of the thumbnail
+	exf := dcraw.GetOrientation(ctx, f)
+	if exf <= 0 {
+		exf = exifOrientation(data)
+	}
+	return rotateflip.Image(img, rotateflip.Orientation(exf).Op()), nil
+}
+
 func exportJPEG(ctx context.Context, path string) ([]byte, error) {
 	log.Print("dcraw (get thumb)...")
 	f, err := os.Open(path)
@@ -41,7 +81,41 @@ func exportJPEG(ctx context.Context, path string) ([]byte, error) {
 	return data, nil
 }
 
-func resampleJPEG(data []byte, settings exportSettings) ([]byte, error) {
+func resampleJPEG(data []byte, settings exportSettings, wm *watermark) ([]byte, error) {
+	img, err := uprightImage(data, settings, wm)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.Buffer{}
+	// https://fotoforensics.com/tutorial.php?tt=estq
+	opt := jpeg.Options{Quality: [13]int{30, 34, 47, 62, 69, 76, 79, 82, 86, 90, 93, 97, 99}[settings.Quality]}
+	if err := jpeg.Encode(&buf, img, &opt); err != nil {
+		return nil, err
+	}
+
+	return append(jfifHeader(settings), buf.Bytes()[2:]...), nil
+}
+
+// exportTIFF converts a JPEG preview into an 8-bit TIFF.
+// This is a preview TIFF: quality is that of the JPEG, only without further compression artifacts.
+func exportTIFF(data []byte, settings exportSettings, wm *watermark) ([]byte, error) {
+	img, err := uprightImage(data, settings, wm)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.Buffer{}
+	opt := tiff.Options{Compression: tiff.Deflate, Predictor: true}
+	if err := tiff.Encode(&buf, img, &opt); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// uprightImage decodes a JPEG, applies its EXIF orientation,
+// and resamples and watermarks it, according to settings.
+func uprightImage(data []byte, settings exportSettings, wm *watermark) (image.Image, error) {
 	img, err := jpeg.Decode(bytes.NewReader(data))
 	if err != nil {
 		return nil, err
@@ -49,17 +123,65 @@ func resampleJPEG(data []byte, settings exportSettings) ([]byte, error) {
 
 	exf := rotateflip.Orientation(exifOrientation(data))
 	img = rotateflip.Image(img, exf.Op())
-	fit := settings.FitImage(img.Bounds().Size())
-	img = resize.Thumbnail(uint(fit.X), uint(fit.Y), img, resize.Lanczos2)
+	if settings.Resample {
+		fit := settings.FitImage(img.Bounds().Size())
+		img = resize.Thumbnail(uint(fit.X), uint(fit.Y), img, resize.Lanczos2)
+	}
+	if wm != nil {
+		img = wm.apply(img, 1)
+	}
+	return img, nil
+}
+
+// watermarkJPEG draws a watermark at full size, keeping the EXIF orientation.
+func watermarkJPEG(data []byte, wm *watermark) ([]byte, error) {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	img = wm.apply(img, exifOrientation(data))
 
 	buf := bytes.Buffer{}
-	// https://fotoforensics.com/tutorial.php?tt=estq
-	opt := jpeg.Options{Quality: [13]int{30, 34, 47, 62, 69, 76, 79, 82, 86, 90, 93, 97, 99}[settings.Quality]}
+	opt := jpeg.Options{Quality: 97}
 	if err := jpeg.Encode(&buf, img, &opt); err != nil {
 		return nil, err
 	}
 
-	return append(jfifHeader(settings), buf.Bytes()[2:]...), nil
+	// keep the EXIF segment, which has the orientation
+	head := []byte("\xff\xd8")
+	if app1 := exifSegment(data); app1 != nil {
+		head = append(head, app1...)
+	}
+	return append(head, buf.Bytes()[2:]...), nil
+}
+
+// exifSegment returns the APP1 segment with EXIF data, if there's one.
+func exifSegment(data []byte) []byte {
+	if !bytes.HasPrefix(data, []byte("\xff\xd8")) {
+		return nil
+	}
+
+	data = data[2:]
+	for len(data) > 4 {
+		marker := binary.BigEndian.Uint16(data)
+		if marker == 0xffff { // padding
+			data = data[1:]
+			continue
+		}
+		if marker < 0xffe0 { // not APPn, JPGn, COM
+			return nil
+		}
+		size := int(binary.BigEndian.Uint16(data[2:])) + 2
+		if size < 4 || size > len(data) {
+			return nil
+		}
+		if marker == 0xffe1 && bytes.HasPrefix(data[4:size], []byte("Exif\x00\x00")) {
+			return data[:size]
+		}
+		data = data[size:]
+	}
+	return nil
 }
 
 func exifOrientation(data []byte) int {
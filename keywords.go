@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ncruces/rethinkraw/internal/config"
+)
+
+// Hierarchical keywords are written like Lightroom does, as "Animals|Birds|Red Kite":
+//  . to lr:hierarchicalSubject, the full path (even for top-level keywords)
+//  . to dc:subject, the keyword and each of its parents
+//
+// The keyword list (a controlled vocabulary, for autocomplete) is kept in DataDir as: "keywords.txt",
+// in the tab-indented format Lightroom uses to export (and import) keywords.
+
+func keywordListFile() string {
+	return filepath.Join(config.DataDir, "keywords.txt")
+}
+
+// loadKeywordList loads the keyword list, as sorted paths.
+func loadKeywordList() ([]string, error) {
+	f, err := os.Open(keywordListFile())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseKeywordList(f)
+}
+
+func saveKeywordList(paths []string) error {
+	name := keywordListFile()
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), "keywords-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(formatKeywordList(paths)); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// parseKeywordList parses a tab-indented keyword list.
+// Synonyms, in {braces}, are skipped; keywords that aren't exported, in [brackets], are kept.
+func parseKeywordList(r io.Reader) ([]string, error) {
+	var parents, paths []string
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		line := strings.TrimRight(scan.Text(), " \r")
+		line = strings.TrimPrefix(line, "\ufeff") // BOM
+		name := strings.TrimLeft(line, "\t")
+		depth := len(line) - len(name)
+		name = strings.TrimSpace(name)
+		if name == "" || strings.HasPrefix(name, "{") {
+			continue
+		}
+		if strings.HasPrefix(name, "[") && strings.HasSuffix(name, "]") {
+			name = strings.TrimSpace(name[1 : len(name)-1])
+		}
+		name = strings.ReplaceAll(name, "|", "/")
+
+		parents = append(parents[:min(depth, len(parents))], name)
+		paths = append(paths, strings.Join(parents, "|"))
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+	return mergeKeywords(nil, paths), nil
+}
+
+// formatKeywordList formats sorted paths as a tab-indented keyword list.
+func formatKeywordList(paths []string) []byte {
+	var buf bytes.Buffer
+	var prev []string
+	for _, path := range paths {
+		names := strings.Split(path, "|")
+		// skip the parents already written
+		i := 0
+		for i < len(prev) && i < len(names)-1 && prev[i] == names[i] {
+			i++
+		}
+		for ; i < len(names); i++ {
+			buf.WriteString(strings.Repeat("\t", i))
+			buf.WriteString(names[i])
+			buf.WriteByte('\n')
+		}
+		prev = names
+	}
+	return buf.Bytes()
+}
+
+// mergeKeywords adds paths to a keyword list, along with their parents.
+func mergeKeywords(list []string, paths []string) []string {
+	list = slices.Clone(list)
+	for _, path := range paths {
+		names := strings.Split(path, "|")
+		for i := range names {
+			list = append(list, strings.Join(names[:i+1], "|"))
+		}
+	}
+	// sort parents before children
+	slices.SortFunc(list, func(a, b string) int {
+		return slices.Compare(strings.Split(a, "|"), strings.Split(b, "|"))
+	})
+	return slices.Compact(list)
+}
+
+// expandKeyword finds the path of a keyword in the keyword list,
+// if the keyword is not a path already, and is the name of a single keyword in the list.
+func expandKeyword(list []string, keyword string) string {
+	if strings.Contains(keyword, "|") {
+		return keyword
+	}
+	var found string
+	for _, path := range list {
+		if i := strings.LastIndexByte(path, '|'); i >= 0 && strings.EqualFold(path[i+1:], keyword) {
+			if found != "" {
+				return keyword
+			}
+			found = path
+		}
+	}
+	if found == "" {
+		return keyword
+	}
+	return found
+}
+
+// keywordSubjects returns the flat keywords (dc:subject) and paths (lr:hierarchicalSubject) for keywords.
+func keywordSubjects(keywords []string) (subjects, hierarchical []string) {
+	for _, k := range keywords {
+		names := strings.Split(k, "|")
+		for _, name := range names {
+			if !slices.Contains(subjects, name) {
+				subjects = append(subjects, name)
+			}
+		}
+		hierarchical = append(hierarchical, k)
+	}
+	return subjects, hierarchical
+}
+
+// joinKeywords is the inverse of keywordSubjects:
+// it returns paths, and the flat keywords that aren't part of a path.
+func joinKeywords(subjects, hierarchical []string) []string {
+	var keywords, names []string
+	for _, path := range hierarchical {
+		keywords = append(keywords, path)
+		names = append(names, strings.Split(path, "|")...)
+	}
+	for _, s := range subjects {
+		if !slices.Contains(names, s) {
+			keywords = append(keywords, s)
+		}
+	}
+	return keywords
+}
+
+// editKeywords adds and removes keywords (by path, or by name).
+func editKeywords(keywords, add, remove []string) []string {
+	keywords = slices.DeleteFunc(slices.Clone(keywords), func(k string) bool {
+		for _, r := range remove {
+			if strings.EqualFold(k, r) || !strings.Contains(r, "|") && strings.HasSuffix(strings.ToLower(k), "|"+strings.ToLower(r)) {
+				return true
+			}
+		}
+		return false
+	})
+	for _, a := range add {
+		if !slices.ContainsFunc(keywords, func(k string) bool { return strings.EqualFold(k, a) }) {
+			keywords = append(keywords, a)
+		}
+	}
+	return keywords
+}
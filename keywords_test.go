@@ -0,0 +1,99 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func Test_parseKeywordList(t *testing.T) {
+	in := "\ufeffAnimals\r\n" +
+		"\tBirds\r\n" +
+		"\t\tRed Kite\r\n" +
+		"\t\t\t{Milvus milvus}\r\n" +
+		"\t\tEagle\r\n" +
+		"[Places]\r\n" +
+		"\tLisbon\r\n" +
+		"\r\n" +
+		"AC|DC\r\n"
+
+	got, err := parseKeywordList(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"AC/DC",
+		"Animals", "Animals|Birds", "Animals|Birds|Eagle", "Animals|Birds|Red Kite",
+		"Places", "Places|Lisbon",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseKeywordList() = %q, want %q", got, want)
+	}
+
+	// formatting round trips
+	got, err = parseKeywordList(strings.NewReader(string(formatKeywordList(want))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("formatKeywordList() = %q, want %q", got, want)
+	}
+}
+
+func Test_mergeKeywords(t *testing.T) {
+	list := []string{"Animals", "Animals|Birds"}
+	got := mergeKeywords(list, []string{"Places|Lisbon", "Animals|Birds|Eagle", "Animals"})
+	want := []string{"Animals", "Animals|Birds", "Animals|Birds|Eagle", "Places", "Places|Lisbon"}
+	if !slices.Equal(got, want) {
+		t.Errorf("mergeKeywords() = %q, want %q", got, want)
+	}
+	if len(list) != 2 {
+		t.Errorf("mergeKeywords() modified list = %q", list)
+	}
+}
+
+func Test_expandKeyword(t *testing.T) {
+	list := []string{"Animals", "Animals|Birds", "Animals|Birds|Eagle", "Flags|Eagle", "Places", "Places|Lisbon"}
+	tests := []struct {
+		keyword string
+		want    string
+	}{
+		{"lisbon", "Places|Lisbon"},
+		{"Birds", "Animals|Birds"},
+		{"Eagle", "Eagle"}, // ambiguous
+		{"Animals", "Animals"},
+		{"Porto", "Porto"},
+		{"Other|Lisbon", "Other|Lisbon"},
+	}
+	for _, tt := range tests {
+		if got := expandKeyword(list, tt.keyword); got != tt.want {
+			t.Errorf("expandKeyword(%q) = %q, want %q", tt.keyword, got, tt.want)
+		}
+	}
+}
+
+func Test_keywordSubjects(t *testing.T) {
+	keywords := []string{"Animals|Birds|Red Kite", "Animals|Birds|Eagle", "Lisbon"}
+	subjects, hierarchical := keywordSubjects(keywords)
+	if want := []string{"Animals", "Birds", "Red Kite", "Eagle", "Lisbon"}; !slices.Equal(subjects, want) {
+		t.Errorf("keywordSubjects() = %q, want %q", subjects, want)
+	}
+	if want := []string{"Animals|Birds|Red Kite", "Animals|Birds|Eagle", "Lisbon"}; !slices.Equal(hierarchical, want) {
+		t.Errorf("keywordSubjects() = %q, want %q", hierarchical, want)
+	}
+	if got := joinKeywords(subjects, hierarchical); !slices.Equal(got, keywords) {
+		t.Errorf("joinKeywords() = %q, want %q", got, keywords)
+	}
+}
+
+func Test_editKeywords(t *testing.T) {
+	keywords := []string{"Animals|Birds|Red Kite", "Lisbon", "Portugal"}
+	got := editKeywords(keywords, []string{"lisbon", "Places|Porto"}, []string{"red kite", "PORTUGAL"})
+	want := []string{"Lisbon", "Places|Porto"}
+	if !slices.Equal(got, want) {
+		t.Errorf("editKeywords() = %q, want %q", got, want)
+	}
+	if len(keywords) != 3 {
+		t.Errorf("editKeywords() modified keywords = %q", keywords)
+	}
+}
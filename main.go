@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"log"
 	"net/url"
 	"os"
@@ -56,6 +58,9 @@ func run() error {
 	pass := flag.String("password", "$PASSWORD", "the password used to authenticate to the server (required)")
 	cert := flag.String("certfile", "", "the PEM encoded certificate `file`")
 	key := flag.String("keyfile", "", "the PEM encoded private key `file`")
+	cat := flag.Bool("catalog", false, "keep a catalog of photo metadata in the data directory")
+	preset := flag.String("preset", "", "export the photos and directories given with the saved export `preset`, without opening the editor")
+	dest := flag.String("dest", "", "the `directory` to export to with -preset (default: that of the first photo)")
 	flag.Usage = func() {
 		w := flag.CommandLine.Output()
 		fmt.Fprintf(w, "usage: %s [OPTION]... DIRECTORY\n", filepath.Base(os.Args[0]))
@@ -69,6 +74,14 @@ func run() error {
 		wine.Startup()
 	}
 
+	if *preset != "" {
+		if config.ServerMode || flag.NArg() == 0 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		return exportPreset(*preset, *dest, flag.Args())
+	}
+
 	serverPort = ":" + strconv.Itoa(*port)
 	var url url.URL
 
@@ -137,8 +150,21 @@ func run() error {
 		if err != nil {
 			return err
 		}
+		if *cat {
+			catalog, err = openCatalog(filepath.Join(config.DataDir, "catalog.db"))
+			if err != nil {
+				return err
+			}
+			catalog.startScanner()
+			if config.ServerMode {
+				catalogUpdate(serverPrefix, true)
+			}
+		}
 		defer func() {
 			http.Shutdown(context.Background())
+			if catalog != nil {
+				catalog.close()
+			}
 			exif.Shutdown()
 			wine.Shutdown()
 			os.RemoveAll(config.TempDir)
@@ -177,3 +203,75 @@ func run() error {
 	}()
 	return cmd.Wait()
 }
+
+// exportPreset exports photos, and directories of photos, with a saved export preset.
+func exportPreset(name, dest string, args []string) error {
+	var exp exportSettings
+	if err := presets.load(name, &exp); errors.Is(err, fs.ErrNotExist) || errors.Is(err, errInvalidName) {
+		return fmt.Errorf("unknown export preset: %s", name)
+	} else if err != nil {
+		return err
+	}
+	if !dngconv.IsInstalled() {
+		return errors.New("Please download and install Adobe DNG Converter.")
+	}
+
+	paths := make([]string, len(args))
+	for i, arg := range args {
+		abs, err := filepath.Abs(arg)
+		if err != nil {
+			return err
+		}
+		paths[i] = abs
+	}
+	photos, err := findPhotos(paths)
+	if err != nil {
+		return err
+	}
+	if len(photos) == 0 {
+		return nil
+	}
+	if dest == "" {
+		dest = filepath.Dir(photos[0].Path)
+	} else if dest, err = filepath.Abs(dest); err != nil {
+		return err
+	}
+
+	exif, err := setupExifTool()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		exif.Shutdown()
+		wine.Shutdown()
+		os.RemoveAll(config.TempDir)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-shutdown
+		cancel()
+	}()
+
+	seq := make(map[string]int, len(photos))
+	for i, photo := range photos {
+		seq[photo.Path] = i + 1
+	}
+	results := batchProcess(ctx, photos, func(ctx context.Context, photo batchPhoto) error {
+		log.Print("export ", photo.Name)
+		return batchProcessPhoto(ctx, photo, seq[photo.Path], dest, xmpSettings{}, exp)
+	})
+
+	var failed int
+	for res := range results {
+		if res.err != nil {
+			log.Printf("%s: %v", res.photo.Name, res.err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to export %d of %d photos", failed, len(photos))
+	}
+	return nil
+}
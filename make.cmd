@@ -21,6 +21,15 @@ IF NOT EXIST %tgt%\utils\dcraw.wasm (
     COPY /Y %tgt%\utils\dcraw.wasm pkg\dcraw\embed\dcraw.wasm
 )
 
+IF NOT EXIST %tgt%\utils\geonames\cities5000.txt (
+    ECHO Download GeoNames...
+    SET "url=https://download.geonames.org/export/dump"
+    IF NOT EXIST %tgt%\utils\geonames MKDIR %tgt%\utils\geonames
+    go run github.com/ncruces/go-fetch "!url!/countryInfo.txt"      %tgt%\utils\geonames\countryInfo.txt
+    go run github.com/ncruces/go-fetch "!url!/admin1CodesASCII.txt" %tgt%\utils\geonames\admin1CodesASCII.txt
+    go run github.com/ncruces/go-fetch -unpack "!url!/cities5000.zip" %tgt%\utils\geonames
+)
+
 IF NOT EXIST assets\normalize.css (
     ECHO Download normalize.css...
     go run github.com/ncruces/go-fetch "https://unpkg.com/@csstools/normalize.css" assets\normalize.css
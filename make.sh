@@ -30,6 +30,15 @@ if [ ! -f "$tgt/MacOS/utils/dcraw.wasm" ]; then
     cp "$tgt/MacOS/utils/dcraw.wasm" "pkg/dcraw/embed/dcraw.wasm"
 fi
 
+if [ ! -f "$tgt/MacOS/utils/geonames/cities5000.txt" ]; then
+    echo Download GeoNames...
+    url="https://download.geonames.org/export/dump"
+    mkdir -p "$tgt/MacOS/utils/geonames"
+    curl -sL "$url/countryInfo.txt"      > "$tgt/MacOS/utils/geonames/countryInfo.txt"
+    curl -sL "$url/admin1CodesASCII.txt" > "$tgt/MacOS/utils/geonames/admin1CodesASCII.txt"
+    curl -sL "$url/cities5000.zip" | funzip > "$tgt/MacOS/utils/geonames/cities5000.txt"
+fi
+
 if [ ! -f "assets/normalize.css" ]; then
     echo Download normalize.css...
     curl -sL "https://unpkg.com/@csstools/normalize.css" > assets/normalize.css
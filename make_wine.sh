@@ -22,6 +22,15 @@ if [ ! -f "$tgt/utils/dcraw.wasm" ]; then
     cp "$tgt/utils/dcraw.wasm" "pkg/dcraw/embed/dcraw.wasm"
 fi
 
+if [ ! -f "$tgt/utils/geonames/cities5000.txt" ]; then
+    echo Download GeoNames...
+    url="https://download.geonames.org/export/dump"
+    mkdir -p "$tgt/utils/geonames"
+    curl -sL "$url/countryInfo.txt"      > "$tgt/utils/geonames/countryInfo.txt"
+    curl -sL "$url/admin1CodesASCII.txt" > "$tgt/utils/geonames/admin1CodesASCII.txt"
+    curl -sL "$url/cities5000.zip" | funzip > "$tgt/utils/geonames/cities5000.txt"
+fi
+
 if [ ! -f "assets/normalize.css" ]; then
     echo Download normalize.css...
     curl -sL "https://unpkg.com/@csstools/normalize.css" > assets/normalize.css
@@ -3,8 +3,17 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ncruces/go-exiftool"
 )
@@ -21,30 +30,220 @@ func getMetaHTML(path string) ([]byte, error) {
 	return exifserver.Command("-htmlFormat", "-groupHeadings", "-long", "-fixBase", path)
 }
 
-func fixMetaDNG(orig, dest, name string) error {
-	opts := []string{"-tagsFromFile", orig, "-fixBase",
-		"-MakerNotes", "-OriginalRawFileName-=" + filepath.Base(orig)}
-	if name != "" {
-		opts = append(opts, "-OriginalRawFileName="+filepath.Base(name))
+// metaTagPattern matches the tags that can be requested as JSON.
+// Tags must name a group, as in "EXIF:ISO" or "XMP-dc:all", so they can't be mistaken for exiftool options.
+var metaTagPattern = regexp.MustCompile(`^[A-Za-z][\w-]*(:[\w-]+)*:[\w*?-]+#?$`)
+
+// getMetaJSON returns the metadata of photos, as exiftool JSON, with tags grouped by location (family 1 groups).
+// Unless tags are given, all tags are returned.
+func getMetaJSON(paths []string, tags ...string) ([]map[string]json.RawMessage, error) {
+	opts := []string{"-json", "-groupHeadings1", "-fixBase"}
+	for _, tag := range tags {
+		if !metaTagPattern.MatchString(tag) {
+			return nil, fmt.Errorf("%w: %q", errInvalidTag, tag)
+		}
+		opts = append(opts, "-"+tag)
+	}
+	opts = append(opts, paths...)
+
+	log.Print("exiftool (get meta json)...")
+	out, err := exifserver.Command(opts...)
+	if err != nil {
+		return nil, err
+	}
+	var res []map[string]json.RawMessage
+	if len(bytes.TrimSpace(out)) == 0 {
+		return res, nil
+	}
+	if err := json.Unmarshal(out, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+var errInvalidTag = errors.New("invalid tag")
+
+// queryExifJSON runs exiftool -json once for photos, and their sidecars (see xmpSidecar),
+// and parses its output with parse.
+// For each photo, it returns the result for the photo, then the one for its sidecar (which prevails),
+// either of which may be missing.
+func queryExifJSON[T any](paths []string, opts []string, parse func([]byte) (map[string]T, error)) (map[string][2]T, error) {
+	files := slices.Clone(paths)
+	sidecars := make(map[string]string, len(paths))
+	for _, path := range paths {
+		sidecar, err := xmpSidecar(path)
+		if err != nil {
+			return nil, err
+		}
+		if sidecar != "" {
+			sidecars[path] = sidecar
+			files = append(files, sidecar)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	out, err := exifserver.Command(append(slices.Clip(opts), files...)...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := parse(out)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := make(map[string][2]T, len(paths))
+	for _, path := range paths {
+		pair := [2]T{res[path]}
+		if sidecar := sidecars[path]; sidecar != "" {
+			pair[1] = res[sidecar]
+		}
+		pairs[path] = pair
+	}
+	return pairs, nil
+}
+
+// parseExifJSON decodes the output of exiftool -json, with an object per file, by path.
+func parseExifJSON[T any](out []byte) (map[string]*T, error) {
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, nil
+	}
+	var files []T
+	if err := json.Unmarshal(out, &files); err != nil {
+		return nil, err
+	}
+	var sources []struct{ SourceFile string }
+	if err := json.Unmarshal(out, &sources); err != nil {
+		return nil, err
 	}
-	opts = append(opts, "-overwrite_original", dest)
 
+	res := make(map[string]*T, len(files))
+	for i := range files {
+		// exiftool uses forward slashes, even on Windows
+		res[filepath.FromSlash(sources[i].SourceFile)] = &files[i]
+	}
+	return res, nil
+}
+
+// Export metadata policies.
+const (
+	metaDefault    = ""           // all for full size exports, none for resampled ones
+	metaAll        = "all"        // all metadata
+	metaNoLocation = "nolocation" // all, except for GPS and location names
+	metaCopyright  = "copyright"  // copyright and contact info only
+	metaNone       = "none"       // no metadata
+)
+
+var locationTags = []string{
+	"GPS:all", "XMP-exif:GPS*",
+	"IPTC:City", "IPTC:Sub-location", "IPTC:Province-State",
+	"IPTC:Country-PrimaryLocationCode", "IPTC:Country-PrimaryLocationName",
+	"XMP-photoshop:City", "XMP-photoshop:State", "XMP-photoshop:Country",
+	"XMP-iptcCore:Location", "XMP-iptcCore:CountryCode",
+	"XMP-iptcExt:LocationCreated", "XMP-iptcExt:LocationShown",
+}
+
+var copyrightTags = []string{
+	"EXIF:Artist", "EXIF:Copyright",
+	"IPTC:By-line", "IPTC:CopyrightNotice", "IPTC:Credit", "IPTC:Source",
+	"XMP-dc:Creator", "XMP-dc:Rights", "XMP-xmpRights:all",
+	"XMP-photoshop:Credit", "XMP-photoshop:Source",
+	"XMP-iptcCore:CreatorContactInfo",
+}
+
+// descriptiveTags is the metadata removed from DNGs,
+// which Adobe DNG Converter copies from the RAW file.
+// XMP-crs is kept, as it has the edits.
+var descriptiveTags = []string{
+	"GPS:all", "IPTC:all", "ExifIFD:all", "IFD0:Artist", "IFD0:Copyright",
+	"XMP-dc:all", "XMP-xmp:all", "XMP-xmpRights:all", "XMP-photoshop:all",
+	"XMP-iptcCore:all", "XMP-iptcExt:all", "XMP-exif:all", "XMP-exifEX:all",
+	"XMP-aux:all", "XMP-tiff:all", "XMP-lr:all", "XMP-mwg-rs:all",
+}
+
+func validMetaPolicy(policy string) bool {
+	switch policy {
+	case metaDefault, metaAll, metaNoLocation, metaCopyright, metaNone:
+		return true
+	}
+	return false
+}
+
+func fixMetaDNG(orig, dest, name, policy string) error {
 	log.Print("exiftool (fix dng)...")
-	_, err := exifserver.Command(opts...)
+	_, err := exifserver.Command(fixMetaDNGArgs(orig, dest, name, policy)...)
 	return err
 }
 
-func fixMetaJPEG(orig, dest string) error {
-	opts := []string{"-tagsFromFile", orig, "-fixBase",
-		"-CommonIFD0", "-ExifIFD:all", "-GPS:all", // https://exiftool.org/forum/index.php?topic=8378.msg43043#msg43043
-		"-IPTC:all", "-XMP-dc:all", "-XMP-dc:Format=",
-		"-fast", "-overwrite_original", dest}
+func fixMetaDNGArgs(orig, dest, name, policy string) []string {
+	var opts []string
+	if policy == metaAll || policy == metaNoLocation {
+		opts = append(opts, "-tagsFromFile", orig, "-fixBase", "-MakerNotes")
+	}
+	opts = append(opts, "-OriginalRawFileName-="+filepath.Base(orig))
+	if name != "" {
+		opts = append(opts, "-OriginalRawFileName="+filepath.Base(name))
+	}
+
+	switch policy {
+	case metaNoLocation:
+		opts = appendTags(opts, "-", "=", locationTags...)
+	case metaCopyright:
+		opts = appendTags(opts, "-", "=", descriptiveTags...)
+		opts = append(opts, "-tagsFromFile", "@")
+		opts = appendTags(opts, "-", "", copyrightTags...)
+	case metaNone:
+		opts = appendTags(opts, "-", "=", descriptiveTags...)
+	}
 
+	return append(opts, "-overwrite_original", dest)
+}
+
+// fixMetaJPEG copies metadata from orig to dest.
+// Set upright if the pixels in dest have been rotated to their final orientation.
+func fixMetaJPEG(orig, dest, policy string, upright bool) error {
+	if policy == metaNone && upright {
+		return nil
+	}
 	log.Print("exiftool (fix jpeg)...")
-	_, err := exifserver.Command(opts...)
+	_, err := exifserver.Command(fixMetaJPEGArgs(orig, dest, policy, upright)...)
 	return err
 }
 
+func fixMetaJPEGArgs(orig, dest, policy string, upright bool) []string {
+	var opts []string
+	switch policy {
+	case metaAll, metaNoLocation:
+		opts = append(opts, "-tagsFromFile", orig, "-fixBase",
+			"-CommonIFD0", "-ExifIFD:all", "-GPS:all", // https://exiftool.org/forum/index.php?topic=8378.msg43043#msg43043
+			"-IPTC:all", "-XMP-dc:all", "-XMP-dc:Format=")
+		if policy == metaNoLocation {
+			opts = appendTags(opts, "--", "", locationTags...)
+		}
+		if upright {
+			opts = append(opts, "--Orientation", "--ExifImageWidth", "--ExifImageHeight")
+		}
+	case metaCopyright, metaNone:
+		opts = append(opts, "-all=")
+		if !upright {
+			opts = append(opts, "-tagsFromFile", "@", "-Orientation")
+		}
+		if policy == metaCopyright {
+			opts = append(opts, "-tagsFromFile", orig)
+			opts = appendTags(opts, "-", "", copyrightTags...)
+		}
+	}
+	return append(opts, "-fast", "-overwrite_original", dest)
+}
+
+func appendTags(opts []string, prefix, suffix string, tags ...string) []string {
+	for _, t := range tags {
+		opts = append(opts, prefix+t+suffix)
+	}
+	return opts
+}
+
 func dngHasEdits(path string) bool {
 	log.Print("exiftool (has edits?)...")
 	out, err := exifserver.Command("-XMP-photoshop:all", path)
@@ -72,3 +271,129 @@ func cameraMatchingWhiteBalance(path string) string {
 	}
 	return "As Shot"
 }
+
+// photoMeta is the metadata used to expand templates, like "© {year} {artist}".
+type photoMeta struct {
+	Name      string    // filename, without extension
+	Date      time.Time // capture time
+	Camera    string
+	Lens      string
+	Rating    int
+	Artist    string
+	Copyright string
+}
+
+func loadPhotoMeta(path string, sidecars ...string) (meta photoMeta, err error) {
+	meta.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	m := make(map[string][]byte)
+	for _, path := range append([]string{path}, sidecars...) {
+		log.Print("exiftool (load meta)...")
+		out, err := exifserver.Command("-short2", "-fast2", "-d", "%Y-%m-%dT%H:%M:%S",
+			"-DateTimeOriginal", "-Make", "-Model", "-LensModel", "-Lens", "-Rating",
+			"-Artist", "-Creator", "-Copyright", "-Rights", path)
+		if err != nil {
+			return meta, err
+		}
+		if err := exiftool.Unmarshal(out, m); err != nil {
+			return meta, err
+		}
+	}
+
+	if v, ok := m["DateTimeOriginal"]; ok {
+		meta.Date, _ = time.ParseInLocation("2006-01-02T15:04:05", string(v), time.Local)
+	}
+	meta.Camera = cameraName(string(m["Make"]), string(m["Model"]))
+	loadString(&meta.Lens, m, "Lens")
+	loadString(&meta.Lens, m, "LensModel")
+	loadInt(&meta.Rating, m, "Rating")
+	loadString(&meta.Artist, m, "Creator")
+	loadString(&meta.Artist, m, "Artist")
+	loadString(&meta.Copyright, m, "Rights")
+	loadString(&meta.Copyright, m, "Copyright")
+	return meta, nil
+}
+
+// cameraName avoids repeating the make, as in "Canon Canon EOS R5".
+func cameraName(maker, model string) string {
+	maker = strings.TrimSpace(maker)
+	model = strings.TrimSpace(model)
+	if maker == "" || strings.HasPrefix(strings.ToLower(model), strings.ToLower(strings.Fields(maker)[0])) {
+		return model
+	}
+	return strings.TrimSpace(maker + " " + model)
+}
+
+// lookup finds the value of a template variable.
+// Dates take an optional Go layout, as in {date:2006-01-02}.
+// Stars repeat an optional symbol (★ by default) for the rating, as in {stars:*}.
+func (m *photoMeta) lookup(name, format string) (string, bool) {
+	switch name {
+	case "name":
+		return m.Name, true
+	case "date":
+		if m.Date.IsZero() {
+			return "", true
+		}
+		if format == "" {
+			format = time.DateOnly
+		}
+		return m.Date.Format(format), true
+	case "year":
+		if m.Date.IsZero() {
+			return "", true
+		}
+		return strconv.Itoa(m.Date.Year()), true
+	case "camera":
+		return m.Camera, true
+	case "lens":
+		return m.Lens, true
+	case "rating":
+		return strconv.Itoa(m.Rating), true
+	case "stars":
+		return strings.Repeat(cmp.Or(format, "★"), max(0, m.Rating)), true
+	case "artist", "creator":
+		return m.Artist, true
+	case "copyright":
+		return m.Copyright, true
+	}
+	return "", false
+}
+
+// expandTemplate replaces {name} and {name:format} variables in tmpl.
+// Use {{ and }} for literal braces.
+func expandTemplate(tmpl string, lookup func(name, format string) (string, bool)) (string, error) {
+	var buf strings.Builder
+	for len(tmpl) > 0 {
+		i := strings.IndexAny(tmpl, "{}")
+		if i < 0 {
+			buf.WriteString(tmpl)
+			break
+		}
+		buf.WriteString(tmpl[:i])
+		brace := tmpl[i]
+		tmpl = tmpl[i+1:]
+
+		if len(tmpl) > 0 && tmpl[0] == brace {
+			buf.WriteByte(brace)
+			tmpl = tmpl[1:]
+			continue
+		}
+		if brace == '}' {
+			return "", errors.New("unexpected } in template")
+		}
+
+		j := strings.IndexByte(tmpl, '}')
+		if j < 0 {
+			return "", errors.New("unterminated { in template")
+		}
+		name, format, _ := strings.Cut(tmpl[:j], ":")
+		val, ok := lookup(strings.ToLower(strings.TrimSpace(name)), format)
+		if !ok {
+			return "", fmt.Errorf("unknown template variable {%s}", name)
+		}
+		buf.WriteString(val)
+		tmpl = tmpl[j+1:]
+	}
+	return buf.String(), nil
+}
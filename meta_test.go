@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"image/jpeg"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ncruces/go-exiftool"
+)
+
+func Test_fixMetaJPEGArgs(t *testing.T) {
+	copiesGPS := func(args []string) bool {
+		return slices.Contains(args, "-GPS:all") && !slices.Contains(args, "--GPS:all")
+	}
+
+	for _, upright := range []bool{false, true} {
+		if args := fixMetaJPEGArgs("orig", "dest", metaAll, upright); !copiesGPS(args) {
+			t.Errorf("fixMetaJPEGArgs(all) = %q, want GPS", args)
+		}
+		for _, policy := range []string{metaNoLocation, metaCopyright, metaNone} {
+			if args := fixMetaJPEGArgs("orig", "dest", policy, upright); copiesGPS(args) {
+				t.Errorf("fixMetaJPEGArgs(%s) = %q, want no GPS", policy, args)
+			}
+		}
+	}
+}
+
+func Test_fixMetaDNGArgs(t *testing.T) {
+	if args := fixMetaDNGArgs("orig", "dest", "name", metaAll); slices.Contains(args, "-GPS:all=") {
+		t.Errorf("fixMetaDNGArgs(all) = %q, want GPS", args)
+	}
+	for _, policy := range []string{metaNoLocation, metaCopyright, metaNone} {
+		args := fixMetaDNGArgs("orig", "dest", "name", policy)
+		if !slices.Contains(args, "-GPS:all=") {
+			t.Errorf("fixMetaDNGArgs(%s) = %q, want no GPS", policy, args)
+		}
+		if i := slices.Index(args, "-tagsFromFile"); i >= 0 && args[i+1] == "orig" && policy != metaNoLocation {
+			t.Errorf("fixMetaDNGArgs(%s) = %q, copies from orig", policy, args)
+		}
+	}
+}
+
+func Test_fixMetaJPEG(t *testing.T) {
+	exe, err := exec.LookPath("exiftool")
+	if err != nil {
+		t.Skip("exiftool not found")
+	}
+	exiftool.Exec = exe
+	if _, err := setupExifTool(); err != nil {
+		t.Fatal(err)
+	}
+	defer exifserver.Shutdown()
+
+	dir := t.TempDir()
+	orig := filepath.Join(dir, "orig.jpg")
+	dest := filepath.Join(dir, "dest.jpg")
+	writeJPEG := func(path string) {
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := jpeg.Encode(f, image.NewGray(image.Rect(0, 0, 16, 16)), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeJPEG(orig)
+	_, err = exifserver.Command("-GPSLatitude=38.7", "-GPSLatitudeRef=N",
+		"-Copyright=Jane Doe", "-overwrite_original", orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, policy := range []string{metaAll, metaNoLocation, metaCopyright, metaNone} {
+		writeJPEG(dest)
+		if err := fixMetaJPEG(orig, dest, policy, false); err != nil {
+			t.Fatal(err)
+		}
+		out, err := exifserver.Command("-short", "-GPS:all", "-Copyright", dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gps := strings.Contains(string(out), "GPSLatitude")
+		copyright := strings.Contains(string(out), "Jane Doe")
+		if gps != (policy == metaAll) {
+			t.Errorf("fixMetaJPEG(%s): GPS = %v", policy, gps)
+		}
+		if copyright != (policy != metaNone) {
+			t.Errorf("fixMetaJPEG(%s): Copyright = %v", policy, copyright)
+		}
+	}
+}
+
+func Test_getMetaJSON_tags(t *testing.T) {
+	tests := []struct {
+		tag string
+		ok  bool
+	}{
+		{"EXIF:ISO", true},
+		{"XMP-dc:all", true},
+		{"Composite:LensID#", true},
+		{"EXIF:ExifIFD:Exposure*", true},
+		{"ISO", false},
+		{"geotag", false},
+		{"-execute", false},
+		{"-o:file", false},
+		{"EXIF:ISO=100", false},
+		{"EXIF:", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := metaTagPattern.MatchString(tt.tag); got != tt.ok {
+			t.Errorf("metaTagPattern(%q) = %v, want %v", tt.tag, got, tt.ok)
+		}
+	}
+
+	if _, err := getMetaJSON([]string{"photo.CR3"}, "EXIF:ISO", "tagsFromFile"); !errors.Is(err, errInvalidTag) {
+		t.Errorf("getMetaJSON() = %v, want %v", err, errInvalidTag)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"strings"
+)
+
+// Metadata templates are saved to DataDir as: "templates/NAME.json".
+//
+// A template has copyright and contact info, and is applied to the sidecar of a photo (see writeSidecar):
+// to a photo, a batch, or to every uploaded photo (if the template says so).
+// Empty fields are left unchanged.
+var metaTemplates = dataStore("templates")
+
+type metaTemplate struct {
+	Creator    string `json:"creator,omitempty"`
+	Copyright  string `json:"copyright,omitempty"` // can use {year}, {date}, {artist}, etc.
+	UsageTerms string `json:"usageterms,omitempty"`
+	RightsURL  string `json:"rightsurl,omitempty"`
+	Email      string `json:"email,omitempty"`
+	Phone      string `json:"phone,omitempty"`
+	Website    string `json:"website,omitempty"`
+	Address    string `json:"address,omitempty"`
+	City       string `json:"city,omitempty"`
+	Region     string `json:"region,omitempty"`
+	PostalCode string `json:"postalcode,omitempty"`
+	Country    string `json:"country,omitempty"`
+	Upload     bool   `json:"upload,omitempty"` // apply to uploaded photos
+}
+
+func (t *metaTemplate) validate() error {
+	for _, s := range []*string{&t.Creator, &t.Copyright, &t.UsageTerms, &t.RightsURL,
+		&t.Email, &t.Phone, &t.Website, &t.Address, &t.City, &t.Region, &t.PostalCode, &t.Country} {
+		*s = strings.TrimSpace(*s)
+	}
+	if t.RightsURL != "" {
+		if _, err := url.ParseRequestURI(t.RightsURL); err != nil {
+			return err
+		}
+	}
+	if strings.Contains(t.Copyright, "{") {
+		// check the syntax, and names of variables
+		var meta photoMeta
+		if _, err := expandTemplate(t.Copyright, meta.lookup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyTemplate writes the fields of a template to the sidecar of a photo.
+func applyTemplate(path string, t metaTemplate) error {
+	copyright := t.Copyright
+	if strings.Contains(copyright, "{") {
+		meta, err := loadPhotoMeta(path)
+		if err != nil {
+			return err
+		}
+		copyright, err = expandTemplate(copyright, meta.lookup)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Print("exiftool (apply template)...")
+	return writeSidecar(path, templateArgs(t, copyright))
+}
+
+func templateArgs(t metaTemplate, copyright string) []string {
+	var opts []string
+	set := func(tag, val string) {
+		if val != "" {
+			opts = append(opts, "-"+tag+"="+exifEscape(val))
+		}
+	}
+	set("XMP-dc:Creator", t.Creator)
+	set("XMP-dc:Rights", copyright)
+	if copyright != "" {
+		opts = append(opts, "-XMP-xmpRights:Marked=True")
+	}
+	set("XMP-xmpRights:UsageTerms", t.UsageTerms)
+	set("XMP-xmpRights:WebStatement", t.RightsURL)
+	set("XMP-iptcCore:CreatorWorkEmail", t.Email)
+	set("XMP-iptcCore:CreatorWorkTelephone", t.Phone)
+	set("XMP-iptcCore:CreatorWorkURL", t.Website)
+	set("XMP-iptcCore:CreatorAddress", t.Address)
+	set("XMP-iptcCore:CreatorCity", t.City)
+	set("XMP-iptcCore:CreatorRegion", t.Region)
+	set("XMP-iptcCore:CreatorPostalCode", t.PostalCode)
+	set("XMP-iptcCore:CreatorCountry", t.Country)
+	return opts
+}
+
+// applyUploadTemplates applies the templates marked for uploads to an uploaded photo.
+func applyUploadTemplates(path string) error {
+	names, err := metaTemplates.list()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		var t metaTemplate
+		if err := metaTemplates.load(name, &t); err != nil {
+			return err
+		}
+		if t.Upload {
+			if err := applyTemplate(path, t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func Test_metaTemplate_validate(t *testing.T) {
+	tests := []struct {
+		tmpl    metaTemplate
+		wantErr bool
+	}{
+		{metaTemplate{}, false},
+		{metaTemplate{Copyright: "© {year} Jane Doe"}, false},
+		{metaTemplate{Copyright: "© {yaer} Jane Doe"}, true},
+		{metaTemplate{Copyright: "© {year Jane Doe"}, true},
+		{metaTemplate{RightsURL: "https://example.com/license"}, false},
+		{metaTemplate{RightsURL: "example"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.tmpl.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("validate(%v) = %v, wantErr %v", tt.tmpl, err, tt.wantErr)
+		}
+	}
+}
+
+func Test_templateArgs(t *testing.T) {
+	tmpl := metaTemplate{
+		Creator:   "Jane Doe",
+		Copyright: "© {year} Jane Doe",
+		Email:     "jane@example.com",
+		Upload:    true,
+	}
+
+	want := []string{
+		"-XMP-dc:Creator=Jane Doe",
+		"-XMP-dc:Rights=© 2024 Jane Doe",
+		"-XMP-xmpRights:Marked=True",
+		"-XMP-iptcCore:CreatorWorkEmail=jane@example.com",
+	}
+	if got := templateArgs(tmpl, "© 2024 Jane Doe"); !slices.Equal(got, want) {
+		t.Errorf("templateArgs() = %q, want %q", got, want)
+	}
+	if got := templateArgs(metaTemplate{}, ""); got != nil {
+		t.Errorf("templateArgs() = %q, want nothing", got)
+	}
+}
@@ -35,3 +35,41 @@ func IsSidecarForExt(r io.Reader, ext string) bool {
 		}
 	}
 }
+
+// GetProperties reads simple properties from a XMP packet.
+// Properties can be stored as either elements or attributes.
+// Missing properties are missing from the result.
+func GetProperties(r io.Reader, props ...xml.Name) map[xml.Name]string {
+	res := make(map[xml.Name]string, len(props))
+	find := func(name xml.Name) (xml.Name, bool) {
+		for _, p := range props {
+			if p.Local == name.Local && p.Space == name.Space {
+				return p, true
+			}
+		}
+		return xml.Name{}, false
+	}
+
+	dec := xml.NewDecoder(r)
+	for len(res) < len(props) {
+		t, err := dec.Token()
+		if err != nil {
+			break
+		}
+
+		if s, ok := t.(xml.StartElement); ok {
+			for _, a := range s.Attr {
+				if p, ok := find(a.Name); ok {
+					res[p] = a.Value
+				}
+			}
+			if p, ok := find(s.Name); ok {
+				t, _ := dec.Token()
+				if v, ok := t.(xml.CharData); ok {
+					res[p] = strings.TrimSpace(string(v))
+				}
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,33 @@
+package xmp
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetProperties(t *testing.T) {
+	const packet = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:xmpDM="http://ns.adobe.com/xmp/1.0/DynamicMedia/"
+    xmp:Rating="3">
+   <xmp:Label>Red</xmp:Label>
+   <xmpDM:good>True</xmpDM:good>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+	rating := xml.Name{Space: "http://ns.adobe.com/xap/1.0/", Local: "Rating"}
+	label := xml.Name{Space: "http://ns.adobe.com/xap/1.0/", Local: "Label"}
+	good := xml.Name{Space: "http://ns.adobe.com/xmp/1.0/DynamicMedia/", Local: "good"}
+	title := xml.Name{Space: "http://purl.org/dc/elements/1.1/", Local: "title"}
+
+	got := GetProperties(strings.NewReader(packet), rating, label, good, title)
+	want := map[xml.Name]string{rating: "3", label: "Red", good: "True"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetProperties() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/ncruces/rethinkraw/internal/config"
+	"github.com/ncruces/rethinkraw/internal/util"
+	"github.com/ncruces/rethinkraw/pkg/osutil"
+)
+
+// Search indexes are kept in DataDir as: "search/ROOTID.json".
+//
+// An index has the searchable metadata of every photo under a root folder.
+// Searches are answered from the last index, which is updated incrementally in the background:
+// only photos (or sidecars) whose size or modification time changed are read again
+// (from the catalog, if enabled).
+
+type searchEntry struct {
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+	XMPTime  time.Time `json:"xmptime,omitzero"` // of the sidecar
+	Keywords []string  `json:"keywords,omitempty"`
+	Title    string    `json:"title,omitempty"`
+	Caption  string    `json:"caption,omitempty"`
+	Camera   string    `json:"camera,omitempty"`
+	Lens     string    `json:"lens,omitempty"`
+	Date     time.Time `json:"date,omitzero"`
+}
+
+type searchIndex struct {
+	sync.Mutex
+	root     string
+	loaded   bool
+	updating chan struct{}           // closed when done
+	entries  map[string]*searchEntry // by path relative to root
+}
+
+var searchIndexes struct {
+	sync.Mutex
+	roots map[string]*searchIndex
+}
+
+func getSearchIndex(root string) *searchIndex {
+	searchIndexes.Lock()
+	defer searchIndexes.Unlock()
+	if searchIndexes.roots == nil {
+		searchIndexes.roots = map[string]*searchIndex{}
+	}
+	idx := searchIndexes.roots[root]
+	if idx == nil {
+		idx = &searchIndex{root: root}
+		searchIndexes.roots[root] = idx
+	}
+	return idx
+}
+
+func (idx *searchIndex) file() string {
+	return filepath.Join(config.DataDir, "search", util.HashedID(idx.root)+".json")
+}
+
+func (idx *searchIndex) load() {
+	idx.entries = map[string]*searchEntry{}
+	if data, err := os.ReadFile(idx.file()); err == nil {
+		var saved struct {
+			Root    string                  `json:"root"`
+			Entries map[string]*searchEntry `json:"entries"`
+		}
+		if err := json.Unmarshal(data, &saved); err == nil && saved.Root == idx.root {
+			idx.entries = saved.Entries
+		}
+	}
+	idx.loaded = true
+}
+
+func (idx *searchIndex) save() error {
+	data, err := json.Marshal(struct {
+		Root    string                  `json:"root"`
+		Entries map[string]*searchEntry `json:"entries"`
+	}{idx.root, idx.entries})
+	if err != nil {
+		return err
+	}
+
+	name := idx.file()
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	temp := name + ".tmp"
+	if err := os.WriteFile(temp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(temp, name)
+}
+
+// refresh starts updating the index in the background, unless it's already being updated.
+// The returned channel is closed when the update is done.
+func (idx *searchIndex) refresh() <-chan struct{} {
+	idx.Lock()
+	defer idx.Unlock()
+	if idx.updating == nil {
+		done := make(chan struct{})
+		idx.updating = done
+		go func() {
+			if err := idx.update(context.Background()); err != nil {
+				log.Print("search: ", err)
+			}
+			idx.Lock()
+			idx.updating = nil
+			idx.Unlock()
+			close(done)
+		}()
+	}
+	return idx.updating
+}
+
+// update brings the index up to date with the files under its root.
+// The index is only locked to read and apply changes, so searches can go on meanwhile;
+// updates must not run concurrently (see refresh).
+func (idx *searchIndex) update(ctx context.Context) error {
+	idx.Lock()
+	if !idx.loaded {
+		idx.load()
+	}
+	current := maps.Clone(idx.entries)
+	idx.Unlock()
+
+	type change struct {
+		rel, path string
+		entry     searchEntry
+	}
+	var changes []change
+	seen := map[string]struct{}{}
+
+	err := filepath.WalkDir(idx.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path != idx.root && errors.Is(err, fs.ErrPermission) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if osutil.HiddenFile(entry) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if _, ok := extensions[strings.ToUpper(filepath.Ext(path))]; !ok {
+			return nil
+		}
+
+		fi, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(idx.root, path)
+		if err != nil {
+			return nil
+		}
+		seen[rel] = struct{}{}
+
+		c := change{rel: rel, path: path}
+		c.entry.Size = fi.Size()
+		c.entry.ModTime = fi.ModTime()
+		if sidecar, _ := xmpSidecar(path); sidecar != "" {
+			if si, err := os.Stat(sidecar); err == nil {
+				c.entry.XMPTime = si.ModTime()
+			}
+		}
+
+		old := current[rel]
+		if old == nil || old.Size != c.entry.Size || !old.ModTime.Equal(c.entry.ModTime) || !old.XMPTime.Equal(c.entry.XMPTime) {
+			changes = append(changes, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	dirty := false
+	for rel := range current {
+		if _, ok := seen[rel]; !ok {
+			delete(current, rel)
+			dirty = true
+		}
+	}
+
+	const batch = 500
+	for chunk := range slices.Chunk(changes, batch) {
+		if err := ctx.Err(); err != nil {
+			break
+		}
+
+		var photos []string
+		for _, c := range chunk {
+			photos = append(photos, c.path)
+		}
+
+		if catalog != nil {
+			entries, err := catalog.load(photos)
+			if err != nil {
+				return err
+			}
+			for _, c := range chunk {
+				entry := c.entry
+				if e := entries[c.path]; e != nil {
+					entry.merge(e.searchEntry())
+				}
+				current[c.rel] = &entry
+			}
+			dirty = true
+			continue
+		}
+
+		metas, err := querySearchMeta(photos)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range chunk {
+			entry := c.entry
+			for _, meta := range metas[c.path] {
+				entry.merge(meta)
+			}
+			current[c.rel] = &entry
+		}
+		dirty = true
+	}
+
+	if !dirty {
+		return nil
+	}
+	idx.Lock()
+	defer idx.Unlock()
+	idx.entries = current
+	return idx.save()
+}
+
+// merge takes metadata from src, which prevails.
+func (e *searchEntry) merge(src *searchEntry) {
+	if src == nil {
+		return
+	}
+	if len(src.Keywords) > 0 {
+		e.Keywords = src.Keywords
+	}
+	if src.Title != "" {
+		e.Title = src.Title
+	}
+	if src.Caption != "" {
+		e.Caption = src.Caption
+	}
+	if src.Camera != "" {
+		e.Camera = src.Camera
+	}
+	if src.Lens != "" {
+		e.Lens = src.Lens
+	}
+	if !src.Date.IsZero() {
+		e.Date = src.Date
+	}
+}
+
+// querySearchMeta runs exiftool once for a batch of photos, and their sidecars.
+func querySearchMeta(paths []string) (map[string][2]*searchEntry, error) {
+	opts := []string{"-json", "-fast2", "-d", "%Y-%m-%dT%H:%M:%S",
+		"-XMP-dc:Subject", "-IPTC:Keywords", "-XMP-dc:Title", "-IPTC:ObjectName",
+		"-XMP-dc:Description", "-IPTC:Caption-Abstract", "-EXIF:ImageDescription",
+		"-DateTimeOriginal", "-Make", "-Model", "-LensModel", "-Lens"}
+
+	log.Printf("exiftool (index %d photos)...", len(paths))
+	return queryExifJSON(paths, opts, parseSearchMeta)
+}
+
+func parseSearchMeta(out []byte) (map[string]*searchEntry, error) {
+	files, err := parseExifJSON[struct {
+		Subject, Keywords                  jsonStrings
+		Title, ObjectName                  jsonString
+		Description                        jsonString
+		CaptionAbstract                    jsonString `json:"Caption-Abstract"`
+		ImageDescription, DateTimeOriginal jsonString
+		Make, Model, LensModel, Lens       jsonString
+	}](out)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*searchEntry, len(files))
+	for path, f := range files {
+		entry := searchEntry{
+			Keywords: f.Subject,
+			Title:    string(f.Title),
+			Caption:  string(f.Description),
+			Camera:   cameraName(string(f.Make), string(f.Model)),
+			Lens:     string(f.LensModel),
+		}
+		if len(entry.Keywords) == 0 {
+			entry.Keywords = f.Keywords
+		}
+		if entry.Title == "" {
+			entry.Title = string(f.ObjectName)
+		}
+		if entry.Caption == "" {
+			entry.Caption = string(f.CaptionAbstract)
+		}
+		if entry.Caption == "" {
+			entry.Caption = strings.TrimSpace(string(f.ImageDescription))
+		}
+		if entry.Lens == "" {
+			entry.Lens = string(f.Lens)
+		}
+		entry.Date, _ = time.ParseInLocation("2006-01-02T15:04:05", string(f.DateTimeOriginal), time.Local)
+		res[path] = &entry
+	}
+	return res, nil
+}
+
+// jsonStrings unmarshals exiftool lists, which may also be a single value.
+type jsonStrings []string
+
+func (s *jsonStrings) UnmarshalJSON(data []byte) error {
+	var list []jsonString
+	if err := json.Unmarshal(data, &list); err != nil {
+		var one jsonString
+		if err := json.Unmarshal(data, &one); err != nil {
+			return err
+		}
+		list = []jsonString{one}
+	}
+	*s = nil
+	for _, v := range list {
+		*s = append(*s, string(v))
+	}
+	return nil
+}
+
+// A searchTerm matches a field (or any field, if empty) that contains the value.
+type searchTerm struct {
+	field, value string
+}
+
+var searchFields = []string{"name", "keyword", "title", "caption", "camera", "lens", "date"}
+
+// parseSearch splits a query into terms, like: bird "red kite" camera:canon date:2024-05.
+func parseSearch(query string) []searchTerm {
+	var terms []searchTerm
+	var word strings.Builder
+	quoted := false
+	flush := func() {
+		if word.Len() == 0 {
+			return
+		}
+		term := searchTerm{value: word.String()}
+		if field, value, ok := strings.Cut(term.value, ":"); ok && slices.Contains(searchFields, strings.ToLower(field)) {
+			term.field = strings.ToLower(field)
+			term.value = strings.Trim(value, `"`)
+		}
+		if term.value != "" {
+			term.value = strings.ToLower(term.value)
+			terms = append(terms, term)
+		}
+		word.Reset()
+	}
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			flush()
+		default:
+			word.WriteRune(r)
+		}
+	}
+	flush()
+	return terms
+}
+
+// match reports if the entry for the photo at rel matches all terms.
+func (e *searchEntry) match(rel string, terms []searchTerm) bool {
+	var date string
+	if !e.Date.IsZero() {
+		date = e.Date.Format("2006-01-02 15:04")
+	}
+
+	for _, term := range terms {
+		fields := map[string][]string{
+			"name":    {filepath.ToSlash(rel)},
+			"keyword": e.Keywords,
+			"title":   {e.Title},
+			"caption": {e.Caption},
+			"camera":  {e.Camera},
+			"lens":    {e.Lens},
+			"date":    {date},
+		}
+
+		found := false
+		for field, values := range fields {
+			if term.field != "" && term.field != field {
+				continue
+			}
+			for _, v := range values {
+				v = strings.ToLower(v)
+				if field == "date" && strings.HasPrefix(v, term.value) ||
+					field != "date" && strings.Contains(v, term.value) {
+					found = true
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// search finds the photos that match query, newest first.
+func (idx *searchIndex) search(query string) []string {
+	terms := parseSearch(query)
+
+	idx.Lock()
+	defer idx.Unlock()
+	if !idx.loaded {
+		idx.load()
+	}
+
+	var res []string
+	for rel, entry := range idx.entries {
+		if len(terms) > 0 && entry.match(rel, terms) {
+			res = append(res, rel)
+		}
+	}
+	slices.SortFunc(res, func(a, b string) int {
+		if c := idx.entries[b].Date.Compare(idx.entries[a].Date); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	return res
+}
+
+func (idx *searchIndex) size() int {
+	idx.Lock()
+	defer idx.Unlock()
+	if !idx.loaded {
+		idx.load()
+	}
+	return len(idx.entries)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ncruces/rethinkraw/internal/config"
+)
+
+func Test_parseSearch(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []searchTerm
+	}{
+		{"", nil},
+		{"Bird", []searchTerm{{"", "bird"}}},
+		{`"red kite"  camera:Canon`, []searchTerm{{"", "red kite"}, {"camera", "canon"}}},
+		{`lens:"70-200" date:2024-05`, []searchTerm{{"lens", "70-200"}, {"date", "2024-05"}}},
+		{"http://example.com", []searchTerm{{"", "http://example.com"}}},
+		{"keyword:", nil},
+	}
+	for _, tt := range tests {
+		if got := parseSearch(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSearch(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func Test_searchEntry_match(t *testing.T) {
+	entry := searchEntry{
+		Keywords: []string{"Birds", "Red Kite"},
+		Title:    "Over the hill",
+		Caption:  "A kite, hunting",
+		Camera:   "Canon EOS R5",
+		Lens:     "RF100-500mm F4.5-7.1 L IS USM",
+		Date:     time.Date(2024, 5, 6, 7, 8, 9, 0, time.Local),
+	}
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"kite", true},
+		{"IMG_0001", true},
+		{"2024/img", true},
+		{"name:kite", false},
+		{"keyword:bird", true},
+		{"keyword:hunting", false},
+		{"caption:hunting", true},
+		{"title:hill", true},
+		{"camera:r5 lens:100-500", true},
+		{"camera:nikon", false},
+		{"date:2024-05", true},
+		{"date:05", false},
+		{`"red kite" 2024-05-06`, true},
+		{"kite eagle", false},
+	}
+	for _, tt := range tests {
+		if got := entry.match("2024/IMG_0001.CR3", parseSearch(tt.query)); got != tt.want {
+			t.Errorf("match(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func Test_parseSearchMeta(t *testing.T) {
+	out := []byte(`[{
+  "SourceFile": "a.CR2",
+  "Subject": ["bird", 2024],
+  "Caption-Abstract": "A caption",
+  "Make": "Canon",
+  "Model": "Canon EOS R5"
+},{
+  "SourceFile": "a.xmp",
+  "Keywords": "single",
+  "Description": "Described",
+  "DateTimeOriginal": "2024-05-06T07:08:09"
+}]`)
+
+	res, err := parseSearchMeta(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, xmp := res["a.CR2"], res["a.xmp"]
+	if raw == nil || xmp == nil {
+		t.Fatalf("parseSearchMeta() = %v", res)
+	}
+	if !reflect.DeepEqual(raw.Keywords, []string{"bird", "2024"}) || raw.Caption != "A caption" || raw.Camera != "Canon EOS R5" {
+		t.Errorf("parseSearchMeta() = %+v", *raw)
+	}
+
+	raw.merge(xmp)
+	if !reflect.DeepEqual(raw.Keywords, []string{"single"}) || raw.Caption != "Described" || raw.Camera != "Canon EOS R5" || raw.Date.IsZero() {
+		t.Errorf("merge() = %+v", *raw)
+	}
+}
+
+func Test_searchIndex_save(t *testing.T) {
+	dir := config.DataDir
+	config.DataDir = t.TempDir()
+	t.Cleanup(func() { config.DataDir = dir })
+
+	idx := &searchIndex{root: "/photos"}
+	idx.load()
+	idx.entries["a.CR2"] = &searchEntry{Size: 1, Keywords: []string{"kite"}, Date: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	idx.entries["b.CR2"] = &searchEntry{Size: 2, Keywords: []string{"kite"}, Date: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if err := idx.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := &searchIndex{root: "/photos"}
+	loaded.load()
+	if got := loaded.search("kite"); !reflect.DeepEqual(got, []string{"b.CR2", "a.CR2"}) {
+		t.Errorf("search() = %v", got)
+	}
+
+	other := &searchIndex{root: "/other"}
+	other.load()
+	if other.size() != 0 {
+		t.Errorf("size() = %d, want 0", other.size())
+	}
+}
+
+func Test_searchIndex_refresh(t *testing.T) {
+	dir := config.DataDir
+	config.DataDir = t.TempDir()
+	t.Cleanup(func() { config.DataDir = dir })
+
+	// an index with a photo that's gone
+	idx := &searchIndex{root: t.TempDir()}
+	idx.load()
+	idx.entries["gone.CR2"] = &searchEntry{Size: 1, Keywords: []string{"kite"}}
+	if err := idx.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	idx = &searchIndex{root: idx.root}
+	done := idx.refresh()
+	if again := idx.refresh(); again != done {
+		t.Error("refresh() started a concurrent update")
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("refresh() never finished")
+	}
+	if n := idx.size(); n != 0 {
+		t.Errorf("size() = %d, want 0", n)
+	}
+
+	saved := &searchIndex{root: idx.root}
+	saved.load()
+	if n := saved.size(); n != 0 {
+		t.Errorf("saved size() = %d, want 0", n)
+	}
+}
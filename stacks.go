@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/fs"
+	"log"
+	"maps"
+	"math/bits"
+	"sync"
+	"time"
+
+	"github.com/ncruces/go-image/resize"
+	"golang.org/x/sync/errgroup"
+)
+
+// Galleries can stack consecutive photos (in display order):
+//  . burst stacks photos taken less than a gap apart (a second, by default)
+//  . similar stacks photos whose thumbnails look alike (close perceptual hashes, made in the background)
+//
+// A collapsed stack shows its cover: the picked photo, the best rated, or the first.
+
+const (
+	stackGap      = time.Second
+	stackDistance = 10 // bits of a 64-bit hash
+)
+
+// stackItems splits items into stacks (which may have a single photo).
+// Items must have metadata, for burst stacks, or hashes, for similar stacks.
+func stackItems(items []galleryItem, mode string, gap time.Duration, hashes map[string]uint64) [][]galleryItem {
+	if gap <= 0 {
+		gap = stackGap
+	}
+
+	same := func(a, b *galleryItem) bool {
+		switch mode {
+		case "burst":
+			da, db := a.meta.date(), b.meta.date()
+			if da.IsZero() || db.IsZero() {
+				return false
+			}
+			d := da.Sub(db)
+			return -gap < d && d < gap
+		case "similar":
+			ha, oka := hashes[a.file]
+			hb, okb := hashes[b.file]
+			return oka && okb && bits.OnesCount64(ha^hb) <= stackDistance
+		}
+		return false
+	}
+
+	var stacks [][]galleryItem
+	for i := range items {
+		if n := len(stacks); n > 0 && same(&stacks[n-1][len(stacks[n-1])-1], &items[i]) {
+			stacks[n-1] = append(stacks[n-1], items[i])
+		} else {
+			stacks = append(stacks, []galleryItem{items[i]})
+		}
+	}
+	return stacks
+}
+
+// stackCover returns the index of the photo that represents a stack.
+func stackCover(stack []galleryItem) int {
+	cover := 0
+	for i, item := range stack {
+		if item.Culling.Flag == "pick" {
+			return i
+		}
+		best := stack[cover].Culling
+		if item.Culling.Flag != "reject" && (best.Flag == "reject" || item.Culling.Rating > best.Rating) {
+			cover = i
+		}
+	}
+	return cover
+}
+
+// dHash is a difference hash of an image:
+// each bit tells if a pixel is brighter than its right neighbor, in a 9×8 grayscale thumbnail.
+func dHash(img image.Image) uint64 {
+	img = resize.Resize(9, 8, img, resize.Bilinear)
+	b := img.Bounds()
+
+	var hash uint64
+	for y := range 8 {
+		for x := range 8 {
+			l := color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y
+			r := color.GrayModel.Convert(img.At(b.Min.X+x+1, b.Min.Y+y)).(color.Gray).Y
+			hash <<= 1
+			if l > r {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// Hashes are of cached thumbnails (see cachedThumb), by thumbnail key,
+// and are saved to DataDir as: "hashes/thumbs.json".
+
+var hashStore = dataStore("hashes")
+
+var hashCache struct {
+	sync.Mutex
+	loaded  bool
+	entries map[string]uint64   // by thumbnail key
+	pending map[string]struct{} // keys being hashed
+	saving  sync.Mutex
+}
+
+// loadGalleryHashes returns the hashes of the thumbnails of photos that are known.
+// Others are hashed in the background, and left out until they're done,
+// so stacks of similar photos fill in as the gallery is reloaded.
+func loadGalleryHashes(paths []string) map[string]uint64 {
+	keys := make(map[string]string, len(paths))
+	for _, path := range paths {
+		if key, _, err := cachedThumbKey(path, thumbSize); err == nil {
+			keys[path] = key
+		}
+	}
+
+	res := make(map[string]uint64, len(keys))
+	missing := map[string]string{}
+
+	hashCache.Lock()
+	if !hashCache.loaded {
+		hashCache.loaded = true
+		if err := hashStore.load("thumbs", &hashCache.entries); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Print("hashes: ", err)
+		}
+	}
+	for path, key := range keys {
+		if hash, ok := hashCache.entries[key]; ok {
+			res[path] = hash
+		} else if _, ok := hashCache.pending[key]; !ok {
+			if hashCache.pending == nil {
+				hashCache.pending = make(map[string]struct{})
+			}
+			hashCache.pending[key] = struct{}{}
+			missing[path] = key
+		}
+	}
+	hashCache.Unlock()
+
+	if len(missing) > 0 {
+		go hashThumbs(missing)
+	}
+	return res
+}
+
+// hashThumbs hashes the thumbnails of photos (given their keys), and saves the hashes.
+// Photos that fail to load are left out.
+func hashThumbs(keys map[string]string) {
+	var group errgroup.Group
+	group.SetLimit(2)
+	for path, key := range keys {
+		group.Go(func() error {
+			defer func() {
+				hashCache.Lock()
+				delete(hashCache.pending, key)
+				hashCache.Unlock()
+			}()
+
+			data, err := cachedThumb(context.Background(), path, thumbSize)
+			if err != nil {
+				return nil
+			}
+			img, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				return nil
+			}
+			hash := dHash(img)
+
+			hashCache.Lock()
+			if hashCache.entries == nil || len(hashCache.entries) > galleryCacheLimit {
+				hashCache.entries = make(map[string]uint64)
+			}
+			hashCache.entries[key] = hash
+			hashCache.Unlock()
+			return nil
+		})
+	}
+	group.Wait()
+
+	hashCache.saving.Lock()
+	defer hashCache.saving.Unlock()
+	hashCache.Lock()
+	entries := maps.Clone(hashCache.entries)
+	hashCache.Unlock()
+	if err := hashStore.save("thumbs", entries); err != nil {
+		log.Print("hashes: ", err)
+	}
+}
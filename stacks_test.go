@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ncruces/rethinkraw/internal/config"
+)
+
+func Test_stackItems(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	at := func(name string, d time.Duration) galleryItem {
+		return galleryItem{Name: name, file: name, meta: &galleryMeta{Date: t0.Add(d)}}
+	}
+	items := []galleryItem{
+		at("a", 0),
+		at("b", 200*time.Millisecond),
+		at("c", 400*time.Millisecond),
+		at("d", 5*time.Second),
+		{Name: "e", file: "e"},
+		at("f", 5*time.Second+100*time.Millisecond),
+	}
+
+	sizes := func(stacks [][]galleryItem) []int {
+		var res []int
+		for _, s := range stacks {
+			res = append(res, len(s))
+		}
+		return res
+	}
+
+	if got := sizes(stackItems(items, "burst", 0, nil)); !slices.Equal(got, []int{3, 1, 1, 1}) {
+		t.Errorf("stackItems(burst) = %v", got)
+	}
+	if got := sizes(stackItems(items, "burst", 10*time.Second, nil)); !slices.Equal(got, []int{4, 1, 1}) {
+		t.Errorf("stackItems(burst, 10s) = %v", got)
+	}
+
+	hashes := map[string]uint64{"a": 0, "b": 0b111, "c": 0xffff_ffff_ffff_ffff, "d": 0xffff_ffff_ffff_fff0}
+	if got := sizes(stackItems(items, "similar", 0, hashes)); !slices.Equal(got, []int{2, 2, 1, 1}) {
+		t.Errorf("stackItems(similar) = %v", got)
+	}
+	if got := sizes(stackItems(items, "", 0, nil)); !slices.Equal(got, []int{1, 1, 1, 1, 1, 1}) {
+		t.Errorf("stackItems() = %v", got)
+	}
+}
+
+func Test_stackCover(t *testing.T) {
+	tests := []struct {
+		stack []culling
+		want  int
+	}{
+		{[]culling{{}, {}, {}}, 0},
+		{[]culling{{Rating: 1}, {Rating: 3}, {Rating: 2}}, 1},
+		{[]culling{{Rating: 5}, {Flag: "pick"}, {Rating: 4}}, 1},
+		{[]culling{{Flag: "reject"}, {}, {Rating: 1}}, 2},
+	}
+	for _, tt := range tests {
+		var stack []galleryItem
+		for _, c := range tt.stack {
+			stack = append(stack, galleryItem{Culling: c})
+		}
+		if got := stackCover(stack); got != tt.want {
+			t.Errorf("stackCover(%v) = %d, want %d", tt.stack, got, tt.want)
+		}
+	}
+}
+
+func Test_dHash(t *testing.T) {
+	pattern := func(noise int) image.Image {
+		img := image.NewGray(image.Rect(0, 0, 90, 80))
+		for y := range 80 {
+			for x := range 90 {
+				v := 128 + 100*math.Sin(float64(x)/15)*math.Cos(float64(y)/13)
+				img.SetGray(x, y, color.Gray{uint8(int(v) + noise*((x*7+y*13)%3-1))})
+			}
+		}
+		return img
+	}
+	flipped := image.NewGray(image.Rect(0, 0, 90, 80))
+	for y := range 80 {
+		for x := range 90 {
+			flipped.SetGray(x, y, color.Gray{uint8(255 - x*2)})
+		}
+	}
+
+	a, b, c := dHash(pattern(0)), dHash(pattern(4)), dHash(flipped)
+	if d := bits.OnesCount64(a ^ b); d > stackDistance {
+		t.Errorf("dHash() distance of similar images = %d", d)
+	}
+	if d := bits.OnesCount64(a ^ c); d <= stackDistance {
+		t.Errorf("dHash() distance of different images = %d", d)
+	}
+}
+
+func Test_loadGalleryHashes(t *testing.T) {
+	dir := config.DataDir
+	config.DataDir = t.TempDir()
+	reset := func() {
+		hashCache.Lock()
+		hashCache.loaded = false
+		hashCache.entries = nil
+		hashCache.Unlock()
+	}
+	t.Cleanup(func() {
+		hashCache.saving.Lock()
+		defer hashCache.saving.Unlock()
+		config.DataDir = dir
+		reset()
+	})
+	reset()
+
+	// a photo with a cached thumbnail
+	path := filepath.Join(t.TempDir(), "a.CR2")
+	if err := os.WriteFile(path, []byte("raw"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	key, _, err := cachedThumbKey(path, thumbSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var thumb bytes.Buffer
+	if err := jpeg.Encode(&thumb, image.NewGray(image.Rect(0, 0, 90, 80)), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(thumbCacheDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(thumbCacheDir(), key+".jpg"), thumb.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first request doesn't wait for hashing
+	if got := loadGalleryHashes([]string{path}); len(got) != 0 {
+		t.Errorf("loadGalleryHashes() = %v, want none", got)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if got := loadGalleryHashes([]string{path}); len(got) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("loadGalleryHashes() never hashed the photo")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// hashes are saved to DataDir
+	var saved map[string]uint64
+	for time.Now().Before(deadline) {
+		if err := hashStore.load("thumbs", &saved); err == nil && len(saved) == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok := saved[key]; !ok {
+		t.Errorf("saved hashes = %v, want %s", saved, key)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ncruces/rethinkraw/internal/config"
+)
+
+// A dataStore keeps named items in a subdirectory of DataDir.
+// Each item is a JSON file, optionally with companion files (e.g. NAME.png).
+type dataStore string
+
+var errInvalidName = errors.New("invalid name")
+
+func (s dataStore) path(name, ext string) (string, error) {
+	if name == "" || name != strings.TrimSpace(name) ||
+		strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\:*?"<>|`) {
+		return "", errInvalidName
+	}
+	return filepath.Join(config.DataDir, string(s), name+ext), nil
+}
+
+func (s dataStore) list() ([]string, error) {
+	files, err := os.ReadDir(filepath.Join(config.DataDir, string(s)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range files {
+		if name, ok := strings.CutSuffix(entry.Name(), ".json"); ok && entry.Type().IsRegular() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s dataStore) load(name string, v any) error {
+	path, err := s.path(name, ".json")
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (s dataStore) save(name string, v any) error {
+	path, err := s.path(name, ".json")
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	return s.write(path, data)
+}
+
+func (s dataStore) write(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".bak", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".bak", path)
+}
+
+// delete removes an item and its companion files.
+func (s dataStore) delete(name string, exts ...string) error {
+	for _, ext := range append([]string{".json"}, exts...) {
+		path, err := s.path(name, ext)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncruces/go-image/resize"
+	"github.com/ncruces/rethinkraw/internal/config"
+	"github.com/ncruces/rethinkraw/pkg/osutil"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
+)
+
+// Thumbnails are cached in DataDir as: "thumbs/KEY.jpg".
+//
+// Photos with edits saved to a sidecar (or DNGs with edits saved to them) get a thumbnail rendered from those edits;
+// others use the preview embedded in the RAW file.
+// Edits are rendered in a private temporary directory, not a workspace,
+// so they don't disturb photos being edited.
+//
+// The KEY hashes the photo's path, the size and modification time of the photo
+// (and its edited sidecar), and the thumbnail size,
+// so changes make new thumbnails, and stale ones are eventually evicted.
+// The cache is kept under thumbCacheLimit by evicting the least recently used thumbnails
+// (modification times of cached files track their use).
+
+const (
+	thumbSize       = 512       // the default bounding box
+	thumbCacheLimit = 256 << 20 // bytes
+)
+
+var thumbCache struct {
+	sync.Mutex
+	size     int64 // bytes, or 0 if unknown
+	evicting bool
+	pregen   map[string]*pregenJob // by gallery
+	group    singleflight.Group
+}
+
+func thumbCacheDir() string {
+	return filepath.Join(config.DataDir, "thumbs")
+}
+
+func thumbKey(path string, size int, files ...fs.FileInfo) string {
+	h := sha256.New()
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(strconv.AppendInt(nil, int64(size), 10))
+	for _, fi := range files {
+		h.Write([]byte{0})
+		h.Write(strconv.AppendInt(nil, fi.Size(), 10))
+		h.Write([]byte{0})
+		h.Write(strconv.AppendInt(nil, fi.ModTime().UnixNano(), 10))
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// editedSidecar returns the sidecar of a photo, if it has Camera Raw settings.
+func editedSidecar(path string) (string, fs.FileInfo) {
+	for _, sidecar := range findSidecar(path) {
+		f, err := os.Open(sidecar)
+		if err != nil {
+			continue
+		}
+		fi, err := f.Stat()
+		if err == nil && hasCameraRawSettings(f) {
+			f.Close()
+			return sidecar, fi
+		}
+		f.Close()
+	}
+	return "", nil
+}
+
+func hasCameraRawSettings(r io.Reader) bool {
+	data, err := io.ReadAll(io.LimitReader(r, 1<<20))
+	return err == nil && bytes.Contains(data, []byte("http://ns.adobe.com/camera-raw-settings/1.0/"))
+}
+
+// cachedThumbKey returns the cache key of a thumbnail, which changes when the photo,
+// or the sidecar with its edits (also returned), do.
+func cachedThumbKey(path string, size int) (key, sidecar string, err error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", "", err
+	}
+	sidecar, si := editedSidecar(path)
+	if sidecar != "" {
+		return thumbKey(path, size, fi, si), sidecar, nil
+	}
+	return thumbKey(path, size, fi), "", nil
+}
+
+// cachedThumb returns a JPEG thumbnail that fits in a size×size box,
+// from the cache, or making (and caching) it.
+func cachedThumb(ctx context.Context, path string, size int) ([]byte, error) {
+	key, sidecar, err := cachedThumbKey(path, size)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Join(thumbCacheDir(), key+".jpg")
+	if data, err := os.ReadFile(name); err == nil {
+		touchThumb(name)
+		return data, nil
+	}
+
+	// concurrent requests for the same thumbnail make it only once;
+	// canceling the first request (or pre-generation) doesn't fail the others
+	res, err, _ := thumbCache.group.Do(key, func() (any, error) {
+		edited := sidecar != "" || strings.EqualFold(filepath.Ext(path), ".dng") && dngHasEdits(path)
+		data, err := makeThumb(context.WithoutCancel(ctx), path, size, edited)
+		if err != nil {
+			return nil, err
+		}
+		if err := saveThumb(name, data); err != nil {
+			log.Print("thumbs: ", err)
+		}
+		return data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.([]byte), nil
+}
+
+func makeThumb(ctx context.Context, path string, size int, edited bool) ([]byte, error) {
+	var img image.Image
+	var err error
+	if edited {
+		img, err = editedThumbImage(ctx, path, size)
+	} else {
+		img, err = thumbImage(ctx, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	img = resize.Thumbnail(uint(size), uint(size), img, resize.Lanczos2)
+
+	buf := bytes.Buffer{}
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// editedThumbImage renders a preview of the edits saved to a photo, or its sidecar.
+func editedThumbImage(ctx context.Context, path string, size int) (image.Image, error) {
+	if err := os.MkdirAll(config.TempDir, 0700); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(config.TempDir, "thumb-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	orig := filepath.Join(dir, "orig"+filepath.Ext(path))
+	temp := filepath.Join(dir, "temp.dng")
+
+	err = osutil.Lnky(path, orig)
+	if err != nil {
+		return nil, err
+	}
+	err = loadSidecar(path, filepath.Join(dir, "orig.xmp"))
+	if err != nil {
+		return nil, err
+	}
+
+	err = runDNGConverter(ctx, orig, temp, max(size, 1024), nil)
+	if err != nil {
+		return nil, err
+	}
+	return thumbImage(ctx, temp)
+}
+
+func saveThumb(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	temp := name + ".tmp"
+	if err := os.WriteFile(temp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(temp, name); err != nil {
+		os.Remove(temp)
+		return err
+	}
+
+	thumbCache.Lock()
+	defer thumbCache.Unlock()
+	if thumbCache.size > 0 {
+		thumbCache.size += int64(len(data))
+	}
+	if thumbCache.size <= 0 || thumbCache.size > thumbCacheLimit {
+		if !thumbCache.evicting {
+			thumbCache.evicting = true
+			go evictThumbs(thumbCacheLimit)
+		}
+	}
+	return nil
+}
+
+// touchThumb marks a thumbnail as used, at most once an hour.
+func touchThumb(name string) {
+	now := time.Now()
+	if fi, err := os.Stat(name); err == nil && now.Sub(fi.ModTime()) > time.Hour {
+		os.Chtimes(name, now, now)
+	}
+}
+
+// evictThumbs removes the least recently used thumbnails,
+// until the cache is under three quarters of limit.
+// It also keeps track of the total size of the cache.
+func evictThumbs(limit int64) {
+	var total int64
+	defer func() {
+		thumbCache.Lock()
+		thumbCache.size = max(1, total)
+		thumbCache.evicting = false
+		thumbCache.Unlock()
+	}()
+
+	entries, err := os.ReadDir(thumbCacheDir())
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Print("thumbs: ", err)
+		}
+		return
+	}
+
+	type thumb struct {
+		name string
+		size int64
+		used time.Time
+	}
+	var thumbs []thumb
+	for _, entry := range entries {
+		if fi, err := entry.Info(); err == nil && fi.Mode().IsRegular() {
+			thumbs = append(thumbs, thumb{entry.Name(), fi.Size(), fi.ModTime()})
+			total += fi.Size()
+		}
+	}
+	if total <= limit {
+		return
+	}
+
+	slices.SortFunc(thumbs, func(a, b thumb) int {
+		return a.used.Compare(b.used)
+	})
+	for _, t := range thumbs {
+		if total <= limit*3/4 {
+			break
+		}
+		if err := os.Remove(filepath.Join(thumbCacheDir(), t.name)); err == nil {
+			total -= t.size
+		}
+	}
+}
+
+type pregenJob struct{ cancel context.CancelFunc }
+
+// pregenThumbs makes thumbnails for a gallery in the background, so they're ready when requested.
+// It cancels any previous pre-generation for the same gallery (only the last page opened matters),
+// but not for other galleries, which other clients may be browsing.
+func pregenThumbs(gallery string, paths []string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &pregenJob{cancel}
+
+	thumbCache.Lock()
+	if prev := thumbCache.pregen[gallery]; prev != nil {
+		prev.cancel()
+	}
+	if thumbCache.pregen == nil {
+		thumbCache.pregen = map[string]*pregenJob{}
+	}
+	thumbCache.pregen[gallery] = job
+	thumbCache.Unlock()
+
+	go func() {
+		defer func() {
+			cancel()
+			thumbCache.Lock()
+			if thumbCache.pregen[gallery] == job {
+				delete(thumbCache.pregen, gallery)
+			}
+			thumbCache.Unlock()
+		}()
+
+		group, ctx := errgroup.WithContext(ctx)
+		group.SetLimit(2)
+		for _, path := range paths {
+			if ctx.Err() != nil {
+				break
+			}
+			group.Go(func() error {
+				cachedThumb(ctx, path, thumbSize)
+				return nil
+			})
+		}
+		group.Wait()
+	}()
+}
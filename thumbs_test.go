@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ncruces/rethinkraw/internal/config"
+)
+
+func Test_thumbKey(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "IMG_0001.CR2")
+	if err := os.WriteFile(path, []byte("raw"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := thumbKey(path, thumbSize, fi)
+	if key != thumbKey(path, thumbSize, fi) {
+		t.Error("thumbKey is not stable")
+	}
+	if key == thumbKey(path, 256, fi) {
+		t.Error("thumbKey ignores the thumbnail size")
+	}
+	if key == thumbKey(filepath.Join(dir, "IMG_0002.CR2"), thumbSize, fi) {
+		t.Error("thumbKey ignores the path")
+	}
+
+	later := fi.ModTime().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err = os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+	if key == thumbKey(path, thumbSize, fi) {
+		t.Error("thumbKey ignores the modification time")
+	}
+}
+
+func Test_evictThumbs(t *testing.T) {
+	dir := config.DataDir
+	config.DataDir = t.TempDir()
+	t.Cleanup(func() {
+		config.DataDir = dir
+		thumbCache.size = 0
+	})
+
+	cache := thumbCacheDir()
+	if err := os.MkdirAll(cache, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// 10 thumbnails of 100 bytes, used an hour apart
+	now := time.Now()
+	for i := range 10 {
+		name := filepath.Join(cache, string(rune('a'+i))+".jpg")
+		if err := os.WriteFile(name, make([]byte, 100), 0600); err != nil {
+			t.Fatal(err)
+		}
+		used := now.Add(time.Duration(i-10) * time.Hour)
+		if err := os.Chtimes(name, used, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	evictThumbs(2000)
+	if entries, _ := os.ReadDir(cache); len(entries) != 10 {
+		t.Errorf("under limit, got %d thumbnails, want 10", len(entries))
+	}
+	if thumbCache.size != 1000 {
+		t.Errorf("got size %d, want 1000", thumbCache.size)
+	}
+
+	evictThumbs(800)
+	entries, _ := os.ReadDir(cache)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if len(names) != 6 || names[0] != "e.jpg" {
+		t.Errorf("over limit, got %v, want the 6 most recently used", names)
+	}
+	if thumbCache.size != 600 {
+		t.Errorf("got size %d, want 600", thumbCache.size)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Capture times are shifted to fix a camera clock that was wrong:
+// by an offset, or so that a reference photo matches its correct time.
+//
+// By default, shifted times are written to the sidecar (see writeSidecar), as XMP exif:DateTimeOriginal and xmp:CreateDate,
+// which prevail over the EXIF in the photo.
+// If requested, EXIF times in the photo (a DNG, or an original) are shifted instead, along with any XMP times.
+//
+// Times are shifted as wall clock times: sub-seconds and time zones are kept.
+
+type timeShift struct {
+	Offset    string // as "[-]H:MM[:SS]", with optional days, as "[-]D H:MM:SS"
+	Reference string // or, the name of a photo in the batch,
+	Time      string // and its correct time, as "2006-01-02T15:04:05"
+	Originals bool   // write to the photos, instead of sidecars
+}
+
+var errNoCaptureTime = errors.New("no capture time")
+
+// exifTime is a wall clock time, as read from EXIF or XMP.
+type exifTime struct {
+	wall time.Time // in UTC, regardless of zone
+	sub  string    // sub-second digits
+	zone string    // as "+01:00", if known
+}
+
+func parseExifTime(s string) (t exifTime, ok bool) {
+	s = strings.TrimSpace(s)
+	if len(s) < len(time.DateTime) {
+		return t, false
+	}
+	wall, err := time.Parse("2006:01:02 15:04:05", s[:len(time.DateTime)])
+	if err != nil {
+		return t, false
+	}
+	rest := s[len(time.DateTime):]
+	if strings.HasPrefix(rest, ".") {
+		i := 1
+		for i < len(rest) && '0' <= rest[i] && rest[i] <= '9' {
+			i++
+		}
+		t.sub, rest = rest[1:i], rest[i:]
+	}
+	if rest != "" && rest != "Z" {
+		if _, err := time.Parse("-07:00", rest); err != nil {
+			return t, false
+		}
+	}
+	t.wall, t.zone = wall, rest
+	return t, true
+}
+
+func (t exifTime) IsZero() bool {
+	return t.wall.IsZero()
+}
+
+func (t exifTime) add(d time.Duration) exifTime {
+	t.wall = t.wall.Add(d)
+	return t
+}
+
+// exif formats t for an EXIF date (without sub-seconds, which are a separate tag).
+func (t exifTime) exif() string {
+	return t.wall.Format("2006:01:02 15:04:05")
+}
+
+// xmp formats t for an XMP date.
+func (t exifTime) xmp() string {
+	s := t.exif()
+	if t.sub != "" {
+		s += "." + t.sub
+	}
+	return s + t.zone
+}
+
+// instant is the moment t refers to, in its own time zone, or loc.
+func (t exifTime) instant(loc *time.Location) time.Time {
+	if z, err := time.Parse("Z07:00", t.zone); err == nil {
+		_, offset := z.Zone()
+		loc = time.FixedZone(t.zone, offset)
+	}
+	nsec, _ := strconv.Atoi((t.sub + "000000000")[:9])
+	w := t.wall
+	return time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), nsec, loc)
+}
+
+func (t exifTime) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	s := t.wall.Format(time.DateTime)
+	if t.sub != "" {
+		s += "." + t.sub
+	}
+	return s
+}
+
+// captureTime has the capture times of a file.
+type captureTime struct {
+	Original, Create       exifTime // EXIF DateTimeOriginal and CreateDate, with sub-seconds
+	XMPOriginal, XMPCreate exifTime // XMP exif:DateTimeOriginal and xmp:CreateDate
+}
+
+// photoTimes has the capture times of a photo, and of its sidecar.
+type photoTimes struct {
+	Photo, Sidecar captureTime
+	sidecar        bool // has an XMP sidecar
+}
+
+// original is the capture time of the photo: from the sidecar, falling back to the photo's XMP, then EXIF.
+func (t *photoTimes) original() exifTime {
+	return cmp.Or(t.Sidecar.XMPOriginal, t.Photo.XMPOriginal, t.Photo.Original)
+}
+
+func (t *photoTimes) create() exifTime {
+	return cmp.Or(t.Sidecar.XMPCreate, t.Photo.XMPCreate, t.Photo.Create)
+}
+
+// loadPhotoTimes loads the capture times of a batch of photos.
+func loadPhotoTimes(paths []string) (map[string]*photoTimes, error) {
+	opts := []string{"-json", "-G0", "-fast2",
+		"-EXIF:DateTimeOriginal", "-EXIF:SubSecTimeOriginal", "-EXIF:CreateDate", "-EXIF:SubSecTimeDigitized",
+		"-XMP-exif:DateTimeOriginal", "-XMP-xmp:CreateDate"}
+
+	log.Printf("exiftool (load capture times for %d photos)...", len(paths))
+	times, err := queryExifJSON(paths, opts, parseCaptureTimes)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*photoTimes, len(paths))
+	for _, path := range paths {
+		var t photoTimes
+		if c := times[path][0]; c != nil {
+			t.Photo = *c
+		}
+		if c := times[path][1]; c != nil {
+			t.Sidecar = *c
+			t.sidecar = true
+		}
+		res[path] = &t
+	}
+	return res, nil
+}
+
+func parseCaptureTimes(out []byte) (map[string]*captureTime, error) {
+	files, err := parseExifJSON[struct {
+		Original       jsonString `json:"EXIF:DateTimeOriginal"`
+		SubSecOriginal jsonString `json:"EXIF:SubSecTimeOriginal"`
+		Create         jsonString `json:"EXIF:CreateDate"`
+		SubSecCreate   jsonString `json:"EXIF:SubSecTimeDigitized"`
+		XMPOriginal    jsonString `json:"XMP:DateTimeOriginal"`
+		XMPCreate      jsonString `json:"XMP:CreateDate"`
+	}](out)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*captureTime, len(files))
+	for path, f := range files {
+		var c captureTime
+		if t, ok := parseExifTime(string(f.Original)); ok {
+			t.sub = strings.TrimSpace(string(f.SubSecOriginal))
+			c.Original = t
+		}
+		if t, ok := parseExifTime(string(f.Create)); ok {
+			t.sub = strings.TrimSpace(string(f.SubSecCreate))
+			c.Create = t
+		}
+		c.XMPOriginal, _ = parseExifTime(string(f.XMPOriginal))
+		c.XMPCreate, _ = parseExifTime(string(f.XMPCreate))
+		res[path] = &c
+	}
+	return res, nil
+}
+
+// parseTimeOffset parses an offset, as "[-]H:MM[:SS]", with optional days, as "[-]D H:MM:SS".
+func parseTimeOffset(offset string) (time.Duration, error) {
+	s := strings.TrimSpace(offset)
+	sign := time.Duration(1)
+	if rest, ok := strings.CutPrefix(s, "-"); ok {
+		sign, s = -1, rest
+	} else {
+		s = strings.TrimPrefix(s, "+")
+	}
+
+	var days int
+	if d, hms, ok := strings.Cut(s, " "); ok {
+		n, err := strconv.Atoi(d)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid time offset: %q", offset)
+		}
+		days, s = n, strings.TrimSpace(hms)
+	}
+
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time offset: %q", offset)
+	}
+	var hms [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || i > 0 && (len(p) != 2 || n > 59) {
+			return 0, fmt.Errorf("invalid time offset: %q", offset)
+		}
+		hms[i] = n
+	}
+
+	d := time.Duration(days)*24*time.Hour +
+		time.Duration(hms[0])*time.Hour +
+		time.Duration(hms[1])*time.Minute +
+		time.Duration(hms[2])*time.Second
+	return sign * d, nil
+}
+
+// offset resolves the offset of a time shift, given the photos of a batch and their times.
+func (s *timeShift) offset(photos []batchPhoto, times map[string]*photoTimes) (time.Duration, error) {
+	if s.Reference == "" {
+		if s.Offset == "" {
+			return 0, errors.New("missing time offset")
+		}
+		return parseTimeOffset(s.Offset)
+	}
+
+	correct, err := time.Parse("2006-01-02T15:04:05", s.Time)
+	if err != nil {
+		correct, err = time.Parse("2006-01-02T15:04", s.Time)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid time: %q", s.Time)
+	}
+	for _, photo := range photos {
+		if photo.Name == s.Reference {
+			t := times[photo.Path].original()
+			if t.IsZero() {
+				return 0, fmt.Errorf("%s: %w", photo.Name, errNoCaptureTime)
+			}
+			return correct.Sub(t.wall), nil
+		}
+	}
+	return 0, fmt.Errorf("reference photo not in batch: %s", s.Reference)
+}
+
+// timeShiftPreview has the old and new capture time of a photo.
+type timeShiftPreview struct {
+	Name string `json:"name"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+// shiftTime shifts the capture times of a photo.
+func shiftTime(path string, t *photoTimes, offset time.Duration, originals bool) error {
+	if t.original().IsZero() && t.create().IsZero() {
+		return errNoCaptureTime
+	}
+	if !originals {
+		log.Print("exiftool (shift capture time)...")
+		return writeSidecar(path, xmpTimeArgs(t.original(), t.create(), offset))
+	}
+
+	opts := xmpTimeArgs(t.Photo.XMPOriginal, t.Photo.XMPCreate, offset)
+	if !t.Photo.Original.IsZero() {
+		opts = append(opts, "-EXIF:DateTimeOriginal="+t.Photo.Original.add(offset).exif())
+	}
+	if !t.Photo.Create.IsZero() {
+		opts = append(opts, "-EXIF:CreateDate="+t.Photo.Create.add(offset).exif())
+	}
+	if len(opts) > 0 {
+		opts = append(opts, "-overwrite_original", path)
+		log.Print("exiftool (shift capture time)...")
+		if _, err := exifserver.Command(opts...); err != nil {
+			return err
+		}
+	}
+	// keep the sidecar, which prevails, consistent
+	if t.sidecar {
+		if opts := xmpTimeArgs(t.Sidecar.XMPOriginal, t.Sidecar.XMPCreate, offset); len(opts) > 0 {
+			return writeSidecar(path, opts)
+		}
+	}
+	catalogUpdate(path, false)
+	return nil
+}
+
+func xmpTimeArgs(original, create exifTime, offset time.Duration) []string {
+	var opts []string
+	if !original.IsZero() {
+		opts = append(opts, "-XMP-exif:DateTimeOriginal="+original.add(offset).xmp())
+	}
+	if !create.IsZero() {
+		opts = append(opts, "-XMP-xmp:CreateDate="+create.add(offset).xmp())
+	}
+	return opts
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func Test_parseExifTime(t *testing.T) {
+	tests := []struct {
+		in   string
+		ok   bool
+		xmp  string
+		exif string
+	}{
+		{"2024:05:06 07:08:09", true, "2024:05:06 07:08:09", "2024:05:06 07:08:09"},
+		{"2024:05:06 07:08:09.50", true, "2024:05:06 07:08:09.50", "2024:05:06 07:08:09"},
+		{"2024:05:06 07:08:09.50+01:00", true, "2024:05:06 07:08:09.50+01:00", "2024:05:06 07:08:09"},
+		{"2024:05:06 07:08:09Z", true, "2024:05:06 07:08:09Z", "2024:05:06 07:08:09"},
+		{"0000:00:00 00:00:00", false, "", ""},
+		{"2024:05:06 07:08:09 junk", false, "", ""},
+		{"2024:05:06", false, "", ""},
+		{"", false, "", ""},
+	}
+	for _, tt := range tests {
+		got, ok := parseExifTime(tt.in)
+		if ok != tt.ok {
+			t.Errorf("parseExifTime(%q) = %v, want %v", tt.in, ok, tt.ok)
+			continue
+		}
+		if ok && (got.xmp() != tt.xmp || got.exif() != tt.exif) {
+			t.Errorf("parseExifTime(%q) = %q, %q, want %q, %q", tt.in, got.xmp(), got.exif(), tt.xmp, tt.exif)
+		}
+	}
+}
+
+func Test_parseTimeOffset(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"1:30", 90 * time.Minute, true},
+		{"+1:30:15", 90*time.Minute + 15*time.Second, true},
+		{"-0:00:10", -10 * time.Second, true},
+		{"-1 2:00:00", -26 * time.Hour, true},
+		{"25:00", 25 * time.Hour, true},
+		{"1:60", 0, false},
+		{"1:5", 0, false},
+		{"1", 0, false},
+		{"x 1:00", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeOffset(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseTimeOffset(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func Test_parseCaptureTimes(t *testing.T) {
+	out := []byte(`[{
+		"SourceFile": "dir/IMG_0001.CR3",
+		"EXIF:DateTimeOriginal": "2024:05:06 07:08:09",
+		"EXIF:SubSecTimeOriginal": 50,
+		"EXIF:CreateDate": "2024:05:06 07:08:10"
+	}, {
+		"SourceFile": "dir/IMG_0001.xmp",
+		"XMP:DateTimeOriginal": "2024:05:06 08:08:09.50+01:00"
+	}]`)
+
+	got, err := parseCaptureTimes(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	photo := got[filepath.FromSlash("dir/IMG_0001.CR3")]
+	sidecar := got[filepath.FromSlash("dir/IMG_0001.xmp")]
+	if photo == nil || sidecar == nil {
+		t.Fatalf("parseCaptureTimes() = %v", got)
+	}
+	if s := photo.Original.xmp(); s != "2024:05:06 07:08:09.50" {
+		t.Errorf("Original = %q", s)
+	}
+	if s := photo.Create.xmp(); s != "2024:05:06 07:08:10" {
+		t.Errorf("Create = %q", s)
+	}
+	if !photo.XMPOriginal.IsZero() || !sidecar.Original.IsZero() {
+		t.Errorf("parseCaptureTimes() = %v, %v", photo, sidecar)
+	}
+
+	times := photoTimes{Photo: *photo, Sidecar: *sidecar}
+	if s := times.original().String(); s != "2024-05-06 08:08:09.50" {
+		t.Errorf("original() = %q", s)
+	}
+	if s := times.create().String(); s != "2024-05-06 07:08:10" {
+		t.Errorf("create() = %q", s)
+	}
+}
+
+func Test_timeShift_offset(t *testing.T) {
+	photos := []batchPhoto{{Path: "a.CR3", Name: "a.CR3"}, {Path: "b.CR3", Name: "b.CR3"}}
+	wall, _ := parseExifTime("2024:05:06 07:08:09")
+	times := map[string]*photoTimes{
+		"a.CR3": {Photo: captureTime{Original: wall}},
+		"b.CR3": {},
+	}
+
+	tests := []struct {
+		shift timeShift
+		want  time.Duration
+		ok    bool
+	}{
+		{timeShift{Offset: "-1:00"}, -time.Hour, true},
+		{timeShift{Reference: "a.CR3", Time: "2024-05-06T08:10:09"}, time.Hour + 2*time.Minute, true},
+		{timeShift{Reference: "a.CR3", Time: "2024-05-05T07:08"}, -24*time.Hour - 9*time.Second, true},
+		{timeShift{Reference: "b.CR3", Time: "2024-05-06T08:10:09"}, 0, false},
+		{timeShift{Reference: "c.CR3", Time: "2024-05-06T08:10:09"}, 0, false},
+		{timeShift{Reference: "a.CR3", Time: "yesterday"}, 0, false},
+		{timeShift{}, 0, false},
+	}
+	for _, tt := range tests {
+		got, err := tt.shift.offset(photos, times)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("offset(%v) = %v, %v, want %v", tt.shift, got, err, tt.want)
+		}
+	}
+}
+
+func Test_xmpTimeArgs(t *testing.T) {
+	original, _ := parseExifTime("2024:12:31 23:30:00.25+01:00")
+	got := xmpTimeArgs(original, exifTime{}, time.Hour)
+	want := []string{"-XMP-exif:DateTimeOriginal=2025:01:01 00:30:00.25+01:00"}
+	if !slices.Equal(got, want) {
+		t.Errorf("xmpTimeArgs() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/ncruces/go-image/resize"
+	"github.com/ncruces/go-image/rotateflip"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Watermarks are drawn over exported JPEGs.
+//
+// A watermark can be a PNG logo, a line of text, or both (the text goes under the logo).
+// Text can use metadata variables, like {copyright} or {date} (see photoMeta).
+//
+// Watermarks are saved to DataDir as: "watermarks/NAME.json" and "watermarks/NAME.png".
+// Exports either reference a saved watermark by name, or specify settings inline
+// (an inline watermark can still use the logo of a saved one).
+
+var watermarks = dataStore("watermarks")
+
+type watermarkSettings struct {
+	Name    string `json:"name,omitempty"`    // a saved watermark
+	Text    string `json:"text,omitempty"`    // text, with metadata variables
+	Logo    string `json:"logo,omitempty"`    // a saved watermark with a PNG logo
+	Anchor  string `json:"anchor,omitempty"`  // nw, n, ne, w, c, e, sw, s, se
+	Opacity int    `json:"opacity,omitempty"` // percent
+	Scale   int    `json:"scale,omitempty"`   // percent of the output width
+	Margin  int    `json:"margin,omitempty"`  // percent of the output short side
+}
+
+func (ws *watermarkSettings) enabled() bool {
+	return ws.Name != "" || ws.Text != "" || ws.Logo != ""
+}
+
+// A watermark that's ready to be drawn.
+type watermark struct {
+	watermarkSettings
+	text string
+	logo image.Image
+}
+
+func loadWatermark(ws watermarkSettings, meta func() (photoMeta, error)) (*watermark, error) {
+	if ws.Name != "" {
+		name := ws.Name
+		ws = watermarkSettings{}
+		if err := watermarks.load(name, &ws); err != nil {
+			return nil, err
+		}
+	}
+
+	wm := watermark{watermarkSettings: ws}
+	if wm.Logo != "" {
+		img, err := loadWatermarkLogo(wm.Logo)
+		if err != nil {
+			return nil, err
+		}
+		wm.logo = img
+	}
+	if wm.Text != "" {
+		meta, err := meta()
+		if err != nil {
+			return nil, err
+		}
+		wm.text, err = expandTemplate(wm.Text, meta.lookup)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if wm.logo == nil && wm.text == "" {
+		return nil, nil
+	}
+
+	if wm.Anchor == "" {
+		wm.Anchor = "se"
+	}
+	if wm.Opacity <= 0 || wm.Opacity > 100 {
+		wm.Opacity = 50
+	}
+	if wm.Scale <= 0 || wm.Scale > 100 {
+		wm.Scale = 20
+	}
+	if wm.Margin < 0 || wm.Margin > 25 {
+		wm.Margin = 0
+	}
+	return &wm, nil
+}
+
+func loadWatermarkLogo(name string) (image.Image, error) {
+	path, err := watermarks.path(name, ".png")
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
+
+// apply draws the watermark over img.
+// The image is stored with EXIF orientation, but the watermark is placed upright.
+func (wm *watermark) apply(img image.Image, orientation int) image.Image {
+	size := img.Bounds().Size()
+	if orientation >= 5 {
+		size.X, size.Y = size.Y, size.X
+	}
+
+	over := wm.render(size)
+	if over == nil {
+		return img
+	}
+
+	// place the watermark, upright
+	short := min(size.X, size.Y)
+	margin := short * wm.Margin / 100
+	rect := over.Bounds().Sub(over.Bounds().Min)
+	rect = rect.Add(anchorPoint(wm.Anchor, size, rect.Size(), margin))
+
+	// then undo the orientation
+	inverse := orientation
+	switch orientation {
+	case 6:
+		inverse = 8
+	case 8:
+		inverse = 6
+	}
+	rect = orientRect(rect, size, inverse).Add(img.Bounds().Min)
+	src := rotateflip.Image(over, rotateflip.Orientation(inverse).Op())
+
+	// draw on a concrete copy, which encoders have fast paths for
+	out := image.NewRGBA(img.Bounds())
+	draw.Draw(out, out.Rect, img, out.Rect.Min, draw.Src)
+	mask := image.NewUniform(color.Alpha{uint8(255 * wm.Opacity / 100)})
+	draw.DrawMask(out, rect, src, src.Bounds().Min, mask, image.Point{}, draw.Over)
+	return out
+}
+
+// render draws the logo and text for an image of the given size.
+func (wm *watermark) render(size image.Point) *image.RGBA {
+	width := size.X * wm.Scale / 100
+	if width <= 0 {
+		return nil
+	}
+
+	var logo image.Image
+	if wm.logo != nil {
+		ls := wm.logo.Bounds().Size()
+		if ls.X > 0 && ls.Y > 0 {
+			logo = resize.Resize(uint(width), uint(max(1, width*ls.Y/ls.X)), wm.logo, resize.Lanczos2)
+		}
+	}
+
+	var text *image.RGBA
+	if wm.text != "" {
+		text = renderText(wm.text, width, max(1, size.Y*wm.Scale/100))
+	}
+
+	var height int
+	if logo != nil {
+		height += logo.Bounds().Dy()
+	}
+	if text != nil {
+		height += text.Bounds().Dy()
+	}
+	if height <= 0 {
+		return nil
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	y := 0
+	if logo != nil {
+		draw.Draw(dst, logo.Bounds().Sub(logo.Bounds().Min), logo, logo.Bounds().Min, draw.Over)
+		y += logo.Bounds().Dy()
+	}
+	if text != nil {
+		x := (width - text.Bounds().Dx()) / 2
+		r := text.Bounds().Sub(text.Bounds().Min).Add(image.Pt(x, y))
+		draw.Draw(dst, r, text, text.Bounds().Min, draw.Over)
+	}
+	return dst
+}
+
+var goRegular = sync.OnceValues(func() (*opentype.Font, error) {
+	return opentype.Parse(goregular.TTF)
+})
+
+// renderText draws white text with a dark shadow,
+// sized to fit within width and height.
+func renderText(text string, width, height int) *image.RGBA {
+	ttf, err := goRegular()
+	if err != nil {
+		return nil
+	}
+
+	// measure at a reference size, then scale to fit
+	const ref = 100
+	face, err := opentype.NewFace(ttf, &opentype.FaceOptions{Size: ref, DPI: 72})
+	if err != nil {
+		return nil
+	}
+	bounds, _ := font.BoundString(face, text)
+	face.Close()
+	bw := (bounds.Max.X - bounds.Min.X).Ceil()
+	bh := (bounds.Max.Y - bounds.Min.Y).Ceil()
+	if bw <= 0 || bh <= 0 {
+		return nil
+	}
+	points := math.Min(float64(ref*width)/float64(bw), float64(ref*height)/float64(bh))
+
+	face, err = opentype.NewFace(ttf, &opentype.FaceOptions{Size: points, DPI: 72})
+	if err != nil {
+		return nil
+	}
+	defer face.Close()
+	bounds, _ = font.BoundString(face, text)
+
+	shadow := max(1, int(points/24))
+	rect := image.Rect(
+		bounds.Min.X.Floor(), bounds.Min.Y.Floor(),
+		bounds.Max.X.Ceil()+shadow, bounds.Max.Y.Ceil()+shadow)
+	dst := image.NewRGBA(rect)
+
+	d := font.Drawer{Dst: dst, Face: face}
+	d.Src = image.NewUniform(color.RGBA{0, 0, 0, 160})
+	d.Dot = fixed.P(shadow, shadow)
+	d.DrawString(text)
+	d.Src = image.White
+	d.Dot = fixed.P(0, 0)
+	d.DrawString(text)
+	return dst
+}
+
+// anchorPoint returns where to place an item of a given size, in an image of a given size.
+func anchorPoint(anchor string, size, item image.Point, margin int) (pt image.Point) {
+	switch anchor {
+	case "nw", "w", "sw":
+		pt.X = margin
+	case "ne", "e", "se":
+		pt.X = size.X - item.X - margin
+	default:
+		pt.X = (size.X - item.X) / 2
+	}
+	switch anchor {
+	case "nw", "n", "ne":
+		pt.Y = margin
+	case "sw", "s", "se":
+		pt.Y = size.Y - item.Y - margin
+	default:
+		pt.Y = (size.Y - item.Y) / 2
+	}
+	return pt
+}
+
+// orientRect maps r, in an image of a given size, as EXIF orientation would.
+func orientRect(r image.Rectangle, size image.Point, orientation int) image.Rectangle {
+	w, h := size.X, size.Y
+	switch orientation {
+	case 2:
+		r = image.Rect(w-r.Max.X, r.Min.Y, w-r.Min.X, r.Max.Y)
+	case 3:
+		r = image.Rect(w-r.Max.X, h-r.Max.Y, w-r.Min.X, h-r.Min.Y)
+	case 4:
+		r = image.Rect(r.Min.X, h-r.Max.Y, r.Max.X, h-r.Min.Y)
+	case 5:
+		r = image.Rect(r.Min.Y, r.Min.X, r.Max.Y, r.Max.X)
+	case 6:
+		r = image.Rect(h-r.Max.Y, r.Min.X, h-r.Min.Y, r.Max.X)
+	case 7:
+		r = image.Rect(h-r.Max.Y, w-r.Max.X, h-r.Min.Y, w-r.Min.X)
+	case 8:
+		r = image.Rect(r.Min.Y, w-r.Max.X, r.Max.Y, w-r.Min.X)
+	}
+	return r
+}
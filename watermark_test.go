@@ -0,0 +1,84 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/ncruces/go-image/rotateflip"
+)
+
+func Test_orientRect(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 5, 3))
+	rect := image.Rect(1, 0, 3, 2)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			src.SetGray(x, y, color.Gray{255})
+		}
+	}
+
+	for orientation := 1; orientation <= 8; orientation++ {
+		dst := rotateflip.Image(src, rotateflip.Orientation(orientation).Op())
+		got := orientRect(rect, src.Bounds().Size(), orientation)
+		if !got.In(dst.Bounds()) {
+			t.Fatalf("orientRect(%d) = %v, out of %v", orientation, got, dst.Bounds())
+		}
+		for y := dst.Bounds().Min.Y; y < dst.Bounds().Max.Y; y++ {
+			for x := dst.Bounds().Min.X; x < dst.Bounds().Max.X; x++ {
+				in := image.Pt(x, y).In(got)
+				if lit := dst.At(x, y).(color.Gray).Y != 0; lit != in {
+					t.Errorf("orientRect(%d) = %v, mismatch at (%d, %d)", orientation, got, x, y)
+				}
+			}
+		}
+	}
+}
+
+func Test_expandTemplate(t *testing.T) {
+	meta := photoMeta{Name: "IMG_0001", Rating: 2, Artist: "Jane Doe"}
+	tests := []struct {
+		tmpl string
+		want string
+		err  bool
+	}{
+		{"", "", false},
+		{"plain", "plain", false},
+		{"{name}", "IMG_0001", false},
+		{"© {Artist}", "© Jane Doe", false},
+		{"{{name}}", "{name}", false},
+		{"{rating:2}", "2", false},
+		{"{stars}", "★★", false},
+		{"{stars:*}", "**", false},
+		{"{unknown}", "", true},
+		{"{name", "", true},
+		{"name}", "", true},
+	}
+	for _, tt := range tests {
+		got, err := expandTemplate(tt.tmpl, meta.lookup)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("expandTemplate(%q) = %q, %v; want %q", tt.tmpl, got, err, tt.want)
+		}
+	}
+}
+
+func Test_watermark_apply(t *testing.T) {
+	logo := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(logo, logo.Rect, image.White, image.Point{}, draw.Src)
+	wm := watermark{
+		watermarkSettings: watermarkSettings{Anchor: "se", Opacity: 100, Scale: 20},
+		logo:              logo,
+	}
+
+	img := image.NewYCbCr(image.Rect(0, 0, 100, 50), image.YCbCrSubsampleRatio420)
+	got, ok := wm.apply(img, 1).(*image.RGBA)
+	if !ok {
+		t.Fatalf("apply() = %T, want *image.RGBA", got)
+	}
+	if r, _, _, _ := got.At(95, 45).RGBA(); r != 0xffff {
+		t.Errorf("apply() at watermark = %v, want white", got.At(95, 45))
+	}
+	if r, _, _, _ := got.At(5, 5).RGBA(); r > 0x1000 {
+		t.Errorf("apply() outside watermark = %v, want black", got.At(5, 5))
+	}
+}
@@ -27,6 +27,7 @@ import (
 //  . orig.EXT - a read-only copy of the original RAW file
 //  . orig.xmp - a sidecar for orig.EXT
 //  . temp.dng - a DNG used as the target for all conversions
+//  . temp.jpg, temp.tif - targets for exports
 //  . edit.dng - a DNG conversion of the original RAW file used for editing previews
 //
 // Editing settings are loaded from orig.xmp or orig.EXT (in that order).
@@ -110,6 +111,11 @@ func (wk *workspace) jpeg() string {
 	return wk.base + "temp.jpg"
 }
 
+// A TIFF used as the target for export.
+func (wk *workspace) tiff() string {
+	return wk.base + "temp.tif"
+}
+
 // A DNG conversion of the original RAW file used for editing previews (downscaled to 2560).
 func (wk *workspace) edit() string {
 	return wk.base + "edit.dng"